@@ -0,0 +1,136 @@
+package songmem
+
+import (
+	"database/sql"
+	"errors"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// Alias is another name of a song. Hearings, that are registered under
+// the alias, are hearings of the song.
+type Alias struct {
+	Name string
+	Song string
+}
+
+// AddAlias makes alias another name of song. Music players often report
+// the same song with slightly different names; with aliases, they are
+// all registered as the same song.
+//
+// Returns ErrSongNotFound, if song does not exist. Fails if there is a
+// song named alias already; use MergeSongs to combine them.
+func (db SongDB) AddAlias(song, alias string) (err error) {
+	alias = strings.TrimSpace(alias)
+	if len(alias) == 0 {
+		return errors.New("the alias is empty")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	id, err := songID(tx, song)
+	if err != nil {
+		return
+	}
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM song WHERE name = ? COLLATE NOCASE)`,
+		alias).Scan(&exists)
+	if err != nil {
+		return
+	} else if exists {
+		return errors.New("a song with the alias' name exists; merge the songs instead")
+	}
+	_, err = tx.Exec(`INSERT INTO alias(name, songID) VALUES (?, ?)`, alias, id)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return errors.New("the alias already exists")
+	}
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// RemoveAlias removes the given alias. The song, that it named, is
+// kept.
+func (db SongDB) RemoveAlias(alias string) (err error) {
+	r, err := db.Exec(`DELETE FROM alias WHERE name = ? COLLATE NOCASE`, alias)
+	if err != nil {
+		return
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n != 1 {
+		err = errors.New("alias not found")
+	}
+	return
+}
+
+// ListAliases lists all aliases, ordered by the name of their song and
+// then by their name.
+func (db SongDB) ListAliases() (aliases []Alias, err error) {
+	rows, err := db.Query(`SELECT alias.name, song.name FROM alias
+	                       INNER JOIN song ON song.id = alias.songID
+	                       ORDER BY song.name, alias.name`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Alias
+		if err = rows.Scan(&a.Name, &a.Song); err != nil {
+			return
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// resolveAlias returns the name of the song, that name is an alias of.
+// If there is a song named name or name is no alias, name is returned.
+func resolveAlias(e execQueryer, name string) (song string, err error) {
+	err = e.QueryRow(`SELECT name FROM song WHERE name = ?1 COLLATE NOCASE
+	                  UNION ALL
+	                  SELECT song.name FROM alias
+	                  INNER JOIN song ON song.id = alias.songID
+	                  WHERE alias.name = ?1 COLLATE NOCASE
+	                  LIMIT 1`, name).Scan(&song)
+	if err == sql.ErrNoRows {
+		return name, nil
+	}
+	return
+}
+
+// aliasSongID returns the ID of the song, that name is an alias of. ok
+// is false, if name is no alias.
+func aliasSongID(e execQueryer, name string) (id int64, ok bool, err error) {
+	err = e.QueryRow(`SELECT songID FROM alias WHERE name = ? COLLATE NOCASE`,
+		name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+// addAliasTable adds the table, that stores the aliases of songs.
+// Aliases are removed together with their song.
+func addAliasTable(db SongDB, tx *sql.Tx) (err error) {
+	commands := [...]string{
+		`CREATE TABLE alias(
+		     id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		     name   TEXT NOT NULL,
+		     songID INTEGER NOT NULL,
+		     FOREIGN KEY(songID) REFERENCES song(id) ON DELETE CASCADE,
+		     CONSTRAINT alias_unique UNIQUE(name COLLATE NOCASE)
+		 )`,
+		`CREATE INDEX alias_songID ON alias(songID)`}
+	for _, c := range commands {
+		if _, err = tx.Exec(c); err != nil {
+			return
+		}
+	}
+	return
+}
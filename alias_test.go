@@ -0,0 +1,106 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	for _, song := range []string{"a", "b"} {
+		if err := db.AddHearingAndSongIfNeeded(song); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	if err := db.AddAlias("a", "A (YouTube)"); err != nil {
+		t.Fatalf("Could not add alias: %v", err)
+	}
+	if err := db.AddAlias("a", "b"); err == nil {
+		t.Errorf("Adding the name of another song as alias did not fail")
+	}
+	if err := db.AddAlias("b", "a (youtube)"); err == nil {
+		t.Errorf("Adding an existing alias did not fail")
+	}
+	if err := db.AddAlias("c", "c (YouTube)"); err != ErrSongNotFound {
+		t.Errorf("Got %v when adding an alias of an unknown song", err)
+	}
+
+	if err := db.AddHearingAndSongIfNeeded("a (youtube)"); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	if err := db.AddHearing("A (YouTube)"); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	songs, err := db.RankFavourites(QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not rank songs: %v", err)
+	}
+	if len(songs) != 2 || songs[0].Name != "a" || songs[0].HearingCount != 3 {
+		t.Errorf("Got %+v, want a with 3 hearings and b", songs)
+	}
+
+	// Aliases are removed together with their song.
+	if err = db.AddSong("c"); err != nil {
+		t.Fatalf("Could not add song: %v", err)
+	}
+	if err = db.AddAlias("c", "c (Live)"); err != nil {
+		t.Fatalf("Could not add alias: %v", err)
+	}
+	if err = db.RemoveSong("c"); err != nil {
+		t.Fatalf("Could not remove song: %v", err)
+	}
+	aliases, err := db.ListAliases()
+	if err != nil {
+		t.Fatalf("Could not list aliases: %v", err)
+	}
+	if want := []Alias{{"A (YouTube)", "a"}}; !reflect.DeepEqual(aliases, want) {
+		t.Errorf("Got aliases %v, want %v", aliases, want)
+	}
+
+	if err = db.RemoveAlias("a (YouTube)"); err != nil {
+		t.Fatalf("Could not remove alias: %v", err)
+	}
+	if err = db.RemoveAlias("a (YouTube)"); err == nil {
+		t.Errorf("Removing an unknown alias did not fail")
+	}
+	if err = db.AddHearing("a (YouTube)"); err != ErrSongNotFound {
+		t.Errorf("Got %v when hearing a removed alias", err)
+	}
+}
+
+func TestAliasNames(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	for _, song := range []string{"a", "b"} {
+		if err := db.AddSong(song); err != nil {
+			t.Fatalf("Could not add song: %v", err)
+		}
+	}
+	if err := db.AddAlias("a", "a (Live)"); err != nil {
+		t.Fatalf("Could not add alias: %v", err)
+	}
+	if err := db.AddSong("A (live)"); err == nil {
+		t.Errorf("Adding a song named like an alias did not fail")
+	}
+	if err := db.RenameSong("b", "a (Live)"); err == nil {
+		t.Errorf("Renaming a song to the alias of another song did not fail")
+	}
+
+	// Renaming a song to its own alias removes the alias.
+	if err := db.RenameSong("a", "a (Live)"); err != nil {
+		t.Fatalf("Could not rename song: %v", err)
+	}
+	aliases, err := db.ListAliases()
+	if err != nil {
+		t.Fatalf("Could not list aliases: %v", err)
+	}
+	if len(aliases) != 0 {
+		t.Errorf("Got aliases %v after renaming to an alias, want none", aliases)
+	}
+	if err = db.AddHearing("a (Live)"); err != nil {
+		t.Errorf("Could not add hearing of the renamed song: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codesoap/songmem"
+	"os"
+	"strings"
+)
+
+// manageAliases adds, removes or lists aliases, depending on the
+// subcommand in conf.
+func manageAliases(db songmem.SongDB, conf conf) (err error) {
+	alias := strings.TrimSpace(conf.AliasName)
+	switch {
+	case conf.Add:
+		sanityCheckName(alias)
+		if err = db.AddAlias(conf.Name, alias); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Added alias \"%s\" of %s\n", alias, conf.Name)
+	case conf.Rm:
+		if err = db.RemoveAlias(alias); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Removed alias \"%s\"\n", alias)
+	case conf.Ls:
+		aliases, err := db.ListAliases()
+		if err != nil {
+			return err
+		}
+		for i, a := range aliases {
+			if i == 0 || a.Song != aliases[i-1].Song {
+				fmt.Println(a.Song)
+			}
+			fmt.Printf("\t%s\n", a.Name)
+		}
+	}
+	return
+}
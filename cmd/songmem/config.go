@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settings are read from the config file. Zero values and nil mean,
+// that the setting was not given.
+type settings struct {
+	FrecencyHalfLife   *time.Duration
+	SuggestionHalfLife *time.Duration
+	SessionGap         time.Duration
+	Separator          *string
+	Library            string
+}
+
+// readSettings reads the config file. A missing config file is not an
+// error.
+//
+// The config file consists of lines like "key = value". Empty lines and
+// lines starting with # are ignored. Values may be quoted like Go
+// strings, to keep leading or trailing spaces.
+func readSettings() (s settings, err error) {
+	filename := getConfigFilename()
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return s, fmt.Errorf("%s:%d: expected a line like 'key = value'", filename, lineNo)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return s, fmt.Errorf("%s:%d: invalid quoted value", filename, lineNo)
+			}
+		}
+		if err = s.set(key, value); err != nil {
+			return s, fmt.Errorf("%s:%d: %v", filename, lineNo, err)
+		}
+	}
+	return s, scanner.Err()
+}
+
+func (s *settings) set(key, value string) (err error) {
+	switch key {
+	case "frecency-half-life":
+		var halfLife time.Duration
+		halfLife, err = parseTimespan(value)
+		s.FrecencyHalfLife = &halfLife
+	case "suggestion-half-life":
+		var halfLife time.Duration
+		halfLife, err = parseTimespan(value)
+		s.SuggestionHalfLife = &halfLife
+	case "session-gap":
+		s.SessionGap, err = parseTimespan(value)
+	case "separator":
+		s.Separator = &value
+	case "library":
+		if strings.HasPrefix(value, "~/") {
+			value = filepath.Join(os.Getenv("HOME"), value[2:])
+		}
+		s.Library = value
+	default:
+		err = fmt.Errorf("unknown setting '%s'", key)
+	}
+	return
+}
+
+func getConfigFilename() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(configDir, "songmem", "config")
+}
+
+// parseTimespan parses a duration like time.ParseDuration, but also
+// accepts days and weeks, like 14d or 2w, on their own.
+func parseTimespan(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+		if err != nil {
+			break
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	return time.ParseDuration(s)
+}
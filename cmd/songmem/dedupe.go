@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/codesoap/songmem"
+	"io"
+	"os"
+	"strings"
+)
+
+// dedupe finds likely duplicate songs. With --report, they are only
+// printed. With --apply, each cluster of duplicates is merged into its
+// most heard song. With --interactive, the user is asked for each
+// cluster, whether it should be merged; if stdin ends, the last answer
+// is still applied, but no further clusters are merged.
+func dedupe(db songmem.SongDB, conf conf) error {
+	clusters, err := db.FindDuplicates()
+	if err != nil {
+		return err
+	}
+	if conf.Report {
+		for _, cluster := range clusters {
+			writeCluster(os.Stdout, cluster)
+		}
+		return nil
+	}
+	answers := bufio.NewReader(os.Stdin)
+	for i, cluster := range clusters {
+		merge, eof := true, false
+		if conf.Interactive {
+			writeCluster(os.Stderr, cluster)
+			fmt.Fprintf(os.Stderr, "Merge into \"%s\"? (%d/%d) [y/N/q] ",
+				cluster[0].Name, i+1, len(clusters))
+			answer, err := answers.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if eof = err == io.EOF; eof {
+				fmt.Fprintln(os.Stderr) // Finish the prompt's line.
+			}
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "q" {
+				return nil
+			}
+			merge = answer == "y"
+		}
+		if merge {
+			if err = mergeCluster(db, cluster); err != nil {
+				return err
+			}
+		}
+		if eof {
+			// Without further answers, the remaining clusters are
+			// left alone instead of guessing.
+			fmt.Fprintln(os.Stderr, "No more answers on stdin; stopping.")
+			return nil
+		}
+	}
+	return nil
+}
+
+// mergeCluster merges all songs of cluster into its first song.
+func mergeCluster(db songmem.SongDB, cluster []songmem.Count) error {
+	var sources []string
+	for _, c := range cluster[1:] {
+		sources = append(sources, c.Name)
+	}
+	if err := db.MergeSongs(sources, cluster[0].Name); err != nil {
+		return err
+	}
+	for _, s := range sources {
+		fmt.Fprintln(os.Stderr, "Merged song", s, "into", cluster[0].Name)
+	}
+	return nil
+}
+
+// writeCluster writes the songs of a cluster of duplicates with their
+// number of hearings. The songs, that would be merged into the first
+// one, are indented.
+func writeCluster(w io.Writer, cluster []songmem.Count) {
+	for i, c := range cluster {
+		indent := ""
+		if i > 0 {
+			indent = "\t"
+		}
+		fmt.Fprintf(w, "%s%s (%d)\n", indent, c.Name, c.Hearings)
+	}
+}
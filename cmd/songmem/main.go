@@ -1,26 +1,70 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/codesoap/songmem"
 	"github.com/docopt/docopt-go"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var usage = `
 Usage:
-    songmem --register [--no-add] <name>
-    songmem
-    songmem --added-at
-    songmem [--omit=<timespan>] --favourite
-    songmem [--omit=<timespan>] --frecent
-    songmem [--omit=<timespan>] --suggestions <name>
+    songmem --register [--no-add] [--at=<time>] <name>
+    songmem [--since=<time>] [--until=<time>] [--limit=<n>] [--offset=<n>]
+    songmem [--since=<time>] [--until=<time>] [--limit=<n>] [--offset=<n>]
+            --added-at
+    songmem [--omit=<timespan>] [--since=<time>] [--until=<time>] [--scores]
+            [--limit=<n>] [--offset=<n>] --favourite
+    songmem [--omit=<timespan>] [--since=<time>] [--until=<time>] [--scores]
+            [--limit=<n>] [--offset=<n>] [--half-life=<timespan>] --frecent
+    songmem [--omit=<timespan>] [--since=<time>] [--until=<time>] [--scores]
+            [--limit=<n>] [--offset=<n>] [--half-life=<timespan>] [--at=<time>]
+            --now-playing-context
+    songmem [--omit=<timespan>] [--since=<time>] [--until=<time>] [--scores]
+            [--limit=<n>] [--offset=<n>] [--half-life=<timespan>]
+            [--aggregate=<method>] [--weights=<weights>]
+            [--direction=<direction>] [--session-gap=<timespan>]
+            --suggestions <seed>...
+    songmem search [--limit=<n>] [--offset=<n>] [--scores] <query>...
     songmem --remove-hearing [<name>]
-    songmem --remove-song [<name>]
+    songmem --remove-hearings [--from=<time>] [--to=<time>] [--dry-run] [<name>]
+    songmem --remove-song [--cascade] [--dry-run] [<name>]
     songmem --rename <name> <newname>
+    songmem merge --into=<name> <source>...
+    songmem dedupe (--report | --apply | --interactive)
+    songmem alias add <name> <alias>
+    songmem alias rm <alias>
+    songmem alias ls
+    songmem [--since=<time>] [--until=<time>] [--limit=<n>] [--offset=<n>]
+            --favourite-artists
+    songmem [--since=<time>] [--until=<time>] [--limit=<n>] [--offset=<n>]
+            --by-artist <artist>
+    songmem --split-names
+    songmem db migrate [--dry-run]
+    songmem import --format=<format> <file>
+    songmem export --format=<format>
+    songmem [--omit=<timespan>] [--since=<time>] [--until=<time>]
+            [--half-life=<timespan>] playlist [--format=<format>] [--limit=<n>]
+            [--offset=<n>] [--library=<dir>]
+            [--aggregate=<method>] [--weights=<weights>]
+            [--direction=<direction>] [--session-gap=<timespan>]
+            [--added-at | --favourite | --frecent | --suggestions <seed>...]
+    songmem [--omit=<timespan>] autoqueue --seed=<name> [--length=<n>]
+            [--temperature=<t>] [--second-order] [--session-gap=<timespan>]
+            [--format=<format>] [--library=<dir>]
+    songmem stats [--from=<time>] [--to=<time>] [--format=<format>]
+    songmem wrapped [--year=<year>] [--format=<format>]
+    songmem sessions [--from=<time>] [--to=<time>] [--session-gap=<timespan>]
+            [--limit=<n>] [--offset=<n>]
+    songmem replay-session [--session-gap=<timespan>] [--format=<format>]
+            [--library=<dir>] <n>
+    songmem watch mpd [--host=<host>] [--port=<port>] [--min-share=<share>]
+            [--min-time=<timespan>]
 Options:
     -h --help         Show this screen.
     -r --register     Register that you just heard a song. If the song does not
@@ -28,37 +72,244 @@ Options:
     -n --no-add       Do not add a song to the database, when registering that
                       you just heard it. If the song does not exist, nothing
                       will happen.
+    -a --at=<time>    Register the hearing at <time> instead of now. For the
+                      now playing context, rank the songs for the time of day
+                      and weekday of <time> instead of now. <time> may be an
+                      RFC3339 timestamp like 2020-05-17T21:30:00+02:00 or
+                      relative to now, like -15m, -2h30m or -3d.
     -t --added-at     List songs by the date of their addition. Newest first.
     -f --favourite    List songs you heard the most. Most heard first.
     -c --frecent      List songs you recently heard a lot. Most frecent first.
+    --now-playing-context  List songs, that you recently heard a lot at this
+                           time of day and weekday, or at the one given with
+                           --at. Best fitting songs first.
     -s --suggestions  List songs, that you often hear before or after hearing
-                      the given song. Best suggestions first.
+                      the given songs, the seeds. Best suggestions first.
     -o --omit=<timespan>  Exclude songs that were heard within <timespan> before
-                          now. <timespan> may be something like 30m or 2h.
-    --remove-hearing  Remove the latest hearing from the database. If <name> is
-                      given, remove the latest hearing of the given song.
+                          now. <timespan> may be something like 30m, 2h or 3d.
+    --since=<time>    Only consider hearings at or after <time>. When listing
+                      songs by the date of their addition, only consider songs
+                      added since then. <time> may be given like for --at,
+                      like 2020-05-17 or like 30d, which means 30 days ago.
+    --until=<time>    Only consider hearings or additions at or before <time>.
+                      A date like 2020-05-17 includes the whole day.
+    --half-life=<timespan>  The age at which a hearing counts half as much
+                            towards frecency; 30d by default. For suggestions,
+                            the time between hearings at which they count half
+                            as much; 1h by default.
+    --aggregate=<method>  How the suggestions for multiple seeds are combined.
+                          One of sum, max or geomean. geomean only lists songs,
+                          that you heard around every seed [default: sum].
+    --weights=<weights>   Comma separated weights of the seeds, like 2,1,1. Each
+                          seed's suggestions count as often as its weight.
+    --direction=<direction>  Which hearings count for suggestions. One of
+                             before, after or both. Use after to find songs,
+                             that typically follow the seeds [default: both].
+    --session-gap=<timespan>  Only count hearings in the same listening session
+                              as a seed. A session ends, when nothing is heard
+                              for longer than <timespan>, like 30m. For the
+                              session commands, this defaults to 30m.
+    --seed=<name>      The song, after which the queue starts.
+    --length=<n>       The number of songs in the queue [default: 30].
+    --temperature=<t>  How adventurous the queue is. At 0, the song that most
+                       often followed the previous one is always picked; at 1,
+                       songs are picked as often as they followed it; higher
+                       values favour rare transitions [default: 1].
+    --second-order     Pick songs by what followed the last two songs, not
+                       just the last one, where possible.
+    --year=<year>      The year to review. Defaults to the current year.
+    --from=<time>      Only include hearings or sessions, that started at or
+                       after <time>. <time> may be given like for --at or like
+                       2020-05-17.
+    --to=<time>        Only include hearings or sessions, that started at or
+                       before <time>. A date like 2020-05-17 includes the whole
+                       day. Sessions are never cut off by --from or --to.
+    --scores          Print the score of each song, followed by a tab, before
+                      the song. For favourites, the score is the number of
+                      hearings.
+    --remove-hearing  Remove the last registered hearing from the database. If
+                      <name> is given, remove the last registered hearing of
+                      the given song. Backfilled hearings count as registered
+                      when they were added, not when they were heard.
+    --remove-hearings  Remove all hearings between --from and --to. If <name>
+                       is given, only remove the hearings of this song.
     --remove-song     Remove the last added song from the database. If <name> is
                       given, remove this song. Fails if there are still hearings
                       of the song.
+    --cascade         Remove the hearings of the song together with it.
     --rename          Rename the song <name> to <newname>.
+    --into=<name>     The song, into which the sources are merged.
+    --report          Only list the likely duplicates.
+    --apply           Merge all likely duplicates.
+    --interactive     Ask for each group of likely duplicates, whether to merge
+                      them. Stops, when stdin ends.
+    --favourite-artists  List artists you heard the most. Most heard first.
+    --by-artist       List the songs of <artist>. Most heard first.
+    --split-names     Take the artist and title of all songs from their names
+                      again, overwriting the current ones.
+    --dry-run         Only list what would be done.
+    --format=<format>  The format of <file>, when importing. One of lastfm-csv,
+                       listenbrainz-json, scrobbler-log or songmem-jsonl. If
+                       <file> is -, the history is read from stdin. When
+                       exporting, one of jsonl or csv. When writing a
+                       playlist, one of m3u8 or xspf; m3u8 is the default.
+                       For stats, one of text or json; text is the default.
+                       For wrapped, one of markdown or html; markdown is the
+                       default.
+    --limit=<n>        Only list the first <n> songs, artists or sessions.
+    --offset=<n>       Skip the first <n> songs, artists or sessions.
+    --library=<dir>    The music library, in which the songs' files are looked
+                       up for playlists. Files are identified by their artist
+                       and title tags or their file name, which should be like
+                       the song's name. Playlists contain paths relative to
+                       <dir>. Defaults to $XDG_MUSIC_DIR or ~/Music.
+    --host=<host>      The host of the MPD server to watch. Defaults to
+                       $MPD_HOST or localhost. A password can be given like
+                       password@host.
+    --port=<port>      The port of the MPD server. Defaults to $MPD_PORT or
+                       6600.
+    --min-share=<share>    Register a hearing once this share of the song was
+                           played [default: 0.5].
+    --min-time=<timespan>  Register a hearing once the song was played this
+                           long, even if --min-share is not reached yet
+                           [default: 4m].
 
 If songmem is called without any arguments, it will list all songs, last heard
-first.
+first. The playlist command takes the same lists; it also defaults to listing
+the songs that were heard last first.
+
+Song names are expected to look like "<artist> - <title>". To use a different
+separator than " - ", set the environment variable SONGMEM_SEPARATOR. It is
+used when adding songs, when splitting the names of songs, that were added
+before songmem knew about artists, when naming songs played by mpd or found in
+the music library and when finding duplicates.
+
+Settings are read from $XDG_CONFIG_HOME/songmem/config or
+~/.config/songmem/config, if it exists. It contains lines like "key = value".
+The keys frecency-half-life, suggestion-half-life, session-gap, separator and
+library set the defaults of --half-life, --session-gap for the session and
+autoqueue commands, SONGMEM_SEPARATOR and --library.
+
+The database schema is updated automatically, whenever songmem is started after
+an update. Before that, a backup of the database is written next to it. Use
+"songmem db migrate --dry-run" to see, which updates are pending.
+
+The autoqueue command writes a playlist of songs, that could follow the seed,
+by learning which songs you heard after which within your listening sessions.
+No song is repeated in the queue.
+
+The stats command prints statistics about your hearings, like your top songs
+and artists and at which times you listen to music.
+
+The wrapped command writes a review of your listening in a year, with your top
+songs and artists, discoveries and the top song of each month.
+
+The sessions command lists your listening sessions, newest first. Sessions are
+numbered, counting back from the latest one; replay-session writes the songs of
+the session with the given number as a playlist, in the order you heard them.
+
+The merge command turns the hearings of the source songs into hearings of the
+song given with --into and removes the sources. This is useful, when a song was
+added twice under different names. The names of the sources become aliases of
+the song, so that their later hearings count for it.
+
+The alias command manages other names of songs. When a hearing of an alias is
+registered, it is registered for its song instead of adding a new song. This is
+useful, when music players name the same song differently. "alias ls" lists
+each song with its aliases. Merged songs become aliases of the song they were
+merged into.
+
+The dedupe command finds songs, that are likely the same song under different
+names. Names are compared ignoring case, accents, punctuation, featured artists
+and version suffixes like "- Remastered 2011" or "(Live)". The artists must be
+the same, but long titles may differ by a few typos. Each group of duplicates is
+listed with the number of hearings of its songs; the most heard song comes
+first and the others would be merged into it.
+
+The search command lists the songs, whose names contain all words of the query,
+best matches first. Words may be the beginning of words in the song names and
+longer words may contain typos. When a song is not found, songs with similar
+names are offered.
+
+The watch command registers the songs played by MPD until it is interrupted.
+Songs are only registered, after they have been played for --min-share of
+their duration or for --min-time, whichever comes first.
 `
 
 type conf struct {
-	Name          string
-	Register      bool
-	NoAdd         bool
-	AddedAt       bool
-	Favourite     bool
-	Frecent       bool
-	Suggestions   bool
-	Omit          string
-	RemoveHearing bool
-	RemoveSong    bool
-	Rename        bool
-	Newname       string
+	Name              string
+	Register          bool
+	NoAdd             bool
+	At                string
+	AddedAt           bool
+	Favourite         bool
+	Frecent           bool
+	NowPlayingContext bool
+	Suggestions       bool
+	Search            bool
+	Query             []string
+	Seed              []string
+	Aggregate         string
+	Weights           string
+	Direction         string
+	SessionGap        string
+	Autoqueue         bool
+	SeedSong          string `docopt:"--seed"`
+	Length            string
+	Temperature       string
+	SecondOrder       bool
+	Stats             bool
+	Wrapped           bool
+	Year              string
+	Sessions          bool
+	ReplaySession     bool `docopt:"replay-session"`
+	From              string
+	To                string
+	N                 string
+	Omit              string
+	Since             string
+	Until             string
+	HalfLife          string
+	Scores            bool
+	RemoveHearing     bool
+	RemoveHearings    bool
+	RemoveSong        bool
+	Cascade           bool
+	Rename            bool
+	Newname           string
+	Merge             bool
+	Into              string
+	Source            []string
+	Dedupe            bool
+	Report            bool
+	Apply             bool
+	Interactive       bool
+	AliasCmd          bool   `docopt:"alias"`
+	AliasName         string `docopt:"<alias>"`
+	Add               bool
+	Rm                bool
+	Ls                bool
+	Artist            string
+	FavouriteArtists  bool
+	ByArtist          bool
+	SplitNames        bool
+	Db                bool
+	Migrate           bool
+	DryRun            bool
+	Import            bool
+	Format            string
+	File              string
+	Export            bool
+	Playlist          bool
+	Limit             string
+	Offset            string
+	Library           string
+	Watch             bool
+	Mpd               bool
+	Host              string
+	Port              string
+	MinShare          string
+	MinTime           string
 }
 
 func main() {
@@ -75,6 +326,14 @@ func main() {
 	}
 	conf.Name = strings.TrimSpace(conf.Name)
 	conf.Newname = strings.TrimSpace(conf.Newname)
+	settings, err := readSettings()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, `Error when reading config file:`, err.Error())
+		os.Exit(22)
+	}
+	if conf.Library == "" {
+		conf.Library = settings.Library
+	}
 
 	db, err := songmem.InitDB(getDBFilename())
 	defer db.Close()
@@ -83,30 +342,107 @@ func main() {
 			err.Error())
 		os.Exit(3)
 	}
-	err = db.CreateSchemaIfNotExists()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, `Error when creating database schema:`,
-			err.Error())
-		os.Exit(4)
+	if settings.Separator != nil {
+		db.Separator = *settings.Separator
+	}
+	if sep, ok := os.LookupEnv("SONGMEM_SEPARATOR"); ok {
+		db.Separator = sep
+	}
+	if !conf.Migrate {
+		_, err = db.Migrate()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when creating database schema:`,
+				err.Error())
+			os.Exit(4)
+		}
 	}
 
 	switch {
+	case conf.Db && conf.Migrate:
+		var migrations []songmem.Migration
+		if conf.DryRun {
+			migrations, err = db.PendingMigrations()
+		} else {
+			migrations, err = db.Migrate()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when migrating database schema:`,
+				err.Error())
+			os.Exit(4)
+		}
+		verb := "Applied"
+		if conf.DryRun {
+			verb = "Would apply"
+		}
+		for _, m := range migrations {
+			fmt.Fprintf(os.Stderr, "%s migration %d: %s\n", verb, m.Version, m.Description)
+		}
+		if len(migrations) == 0 {
+			fmt.Fprintln(os.Stderr, "The database schema is up to date.")
+		}
 	case conf.Register && conf.NoAdd:
-		err = db.AddHearing(conf.Name)
+		at := parseTimeOrExit(conf.At, 5)
+		err = db.AddHearingAt(conf.Name, at)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when adding hearing:`, err.Error())
+			printDidYouMean(db, err, conf.Name)
 			os.Exit(5)
 		}
 	case conf.Register:
 		sanityCheckName(conf.Name)
-		err = db.AddHearingAndSongIfNeeded(conf.Name)
+		at := parseTimeOrExit(conf.At, 6)
+		err = db.AddHearingAndSongIfNeededAt(conf.Name, at)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when adding song or hearing:`,
 				err.Error())
 			os.Exit(6)
 		}
+	case conf.Playlist:
+		opts := suggestionOptions(conf, settings, 17)
+		if err = writePlaylist(db, conf, opts); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when writing playlist:`, err.Error())
+			printDidYouMean(db, err, conf.Seed...)
+			os.Exit(17)
+		}
+	case conf.Autoqueue:
+		if err = writeAutoqueue(db, conf, sessionGap(conf, settings, 25)); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when generating queue:`, err.Error())
+			printDidYouMean(db, err, strings.TrimSpace(conf.SeedSong))
+			os.Exit(25)
+		}
+	case conf.Stats:
+		if err = printStats(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when printing stats:`, err.Error())
+			os.Exit(27)
+		}
+	case conf.Wrapped:
+		if err = writeYearInReview(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when writing review:`, err.Error())
+			os.Exit(28)
+		}
+	case conf.Sessions:
+		if err = printSessions(db, conf, sessionGap(conf, settings, 23)); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when listing sessions:`, err.Error())
+			os.Exit(23)
+		}
+	case conf.ReplaySession:
+		if err = replaySession(db, conf, sessionGap(conf, settings, 24)); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when replaying session:`, err.Error())
+			os.Exit(24)
+		}
+	case conf.Search:
+		if err = printSearch(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when searching songs:`, err.Error())
+			os.Exit(29)
+		}
+	case conf.Watch && conf.Mpd:
+		if err = watchMPD(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when watching MPD:`, err.Error())
+			os.Exit(18)
+		}
 	case conf.AddedAt:
-		songs, err := db.ListSongsInOrderOfAddition()
+		opts := queryOptions(conf, settings, 7)
+		songs, err := db.ListSongsInOrderOfAdditionWithOptions(opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
 			os.Exit(7)
@@ -115,65 +451,38 @@ func main() {
 			fmt.Println(s)
 		}
 	case conf.Favourite:
-		var songs []string
-		if conf.Omit != "" {
-			omit, err := time.ParseDuration(conf.Omit)
-			if err != nil {
-				errMsg := `Could not parse duration "` + conf.Omit + `":`
-				fmt.Fprintln(os.Stderr, errMsg, err.Error())
-				os.Exit(8)
-			}
-			songs, err = db.ListFavouriteSongsOmitting(omit)
-		} else {
-			songs, err = db.ListFavouriteSongs()
-		}
+		opts := queryOptions(conf, settings, 8)
+		songs, err := db.RankFavourites(opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
 			os.Exit(8)
 		}
-		for _, s := range songs {
-			fmt.Println(s)
-		}
+		printRanking(songs, conf.Scores)
 	case conf.Frecent:
-		var songs []string
-		if conf.Omit != "" {
-			omit, err := time.ParseDuration(conf.Omit)
-			if err != nil {
-				errMsg := `Could not parse duration "` + conf.Omit + `":`
-				fmt.Fprintln(os.Stderr, errMsg, err.Error())
-				os.Exit(9)
-			}
-			songs, err = db.ListFrecentSongsOmitting(omit)
-		} else {
-			songs, err = db.ListFrecentSongs()
-		}
+		opts := queryOptions(conf, settings, 9)
+		songs, err := db.RankFrecentSongs(opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
 			os.Exit(9)
 		}
-		for _, s := range songs {
-			fmt.Println(s)
+		printRanking(songs, conf.Scores)
+	case conf.NowPlayingContext:
+		opts := queryOptions(conf, settings, 26)
+		songs, err := db.RankSongsForTimeOfDay(parseTimeOrExit(conf.At, 26), opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
+			os.Exit(26)
 		}
+		printRanking(songs, conf.Scores)
 	case conf.Suggestions:
-		var songs []string
-		if conf.Omit != "" {
-			omit, err := time.ParseDuration(conf.Omit)
-			if err != nil {
-				errMsg := `Could not parse duration "` + conf.Omit + `":`
-				fmt.Fprintln(os.Stderr, errMsg, err.Error())
-				os.Exit(10)
-			}
-			songs, err = db.ListSuggestionsOmitting(conf.Name, omit)
-		} else {
-			songs, err = db.ListSuggestions(conf.Name)
-		}
+		opts := suggestionOptions(conf, settings, 10)
+		songs, err := db.RankSuggestionsForSeeds(conf.Seed, opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
+			printDidYouMean(db, err, conf.Seed...)
 			os.Exit(10)
 		}
-		for _, s := range songs {
-			fmt.Println(s)
-		}
+		printRanking(songs, conf.Scores)
 	case conf.RemoveHearing:
 		song := conf.Name
 		if len(conf.Name) > 0 {
@@ -183,31 +492,101 @@ func main() {
 		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when removing hearing:`, err.Error())
+			printDidYouMean(db, err, conf.Name)
 			os.Exit(11)
 		}
 		fmt.Fprintln(os.Stderr, "Removed latest hearing of:", song)
-	case conf.RemoveSong:
-		song := conf.Name
-		if len(conf.Name) > 0 {
-			err = db.RemoveSong(conf.Name)
-		} else {
-			song, err = db.RemoveLastAddedSong()
+	case conf.RemoveHearings:
+		if err = removeHearings(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when removing hearings:`, err.Error())
+			printDidYouMean(db, err, conf.Name)
+			os.Exit(33)
 		}
-		if err != nil {
+	case conf.RemoveSong:
+		if err = removeSong(db, conf); err != nil {
 			fmt.Fprintln(os.Stderr, `Error when removing song:`, err.Error())
+			printDidYouMean(db, err, conf.Name)
 			os.Exit(12)
 		}
-		fmt.Fprintln(os.Stderr, "Removed song:", song)
 	case conf.Rename:
 		sanityCheckName(conf.Newname)
 		err = db.RenameSong(conf.Name, conf.Newname)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when renaming song:`, err.Error())
+			printDidYouMean(db, err, conf.Name)
 			os.Exit(13)
 		}
 		fmt.Fprintln(os.Stderr, "Renamed song", conf.Name, "to", conf.Newname)
+	case conf.Merge:
+		into := strings.TrimSpace(conf.Into)
+		sources := make([]string, len(conf.Source))
+		for i, s := range conf.Source {
+			sources[i] = strings.TrimSpace(s)
+		}
+		if err = db.MergeSongs(sources, into); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when merging songs:`, err.Error())
+			printDidYouMean(db, err, append(sources, into)...)
+			os.Exit(30)
+		}
+		for _, s := range sources {
+			fmt.Fprintln(os.Stderr, "Merged song", s, "into", into)
+		}
+	case conf.Dedupe:
+		if err = dedupe(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when merging duplicates:`, err.Error())
+			os.Exit(31)
+		}
+	case conf.AliasCmd:
+		if err = manageAliases(db, conf); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when managing aliases:`, err.Error())
+			printDidYouMean(db, err, conf.Name)
+			os.Exit(32)
+		}
+	case conf.FavouriteArtists:
+		artists, err := db.ListFavouriteArtistsWithOptions(queryOptions(conf, settings, 19))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when listing artists:`, err.Error())
+			os.Exit(19)
+		}
+		for _, a := range artists {
+			fmt.Println(a)
+		}
+	case conf.ByArtist:
+		songs, err := db.ListSongsByArtistWithOptions(strings.TrimSpace(conf.Artist),
+			queryOptions(conf, settings, 20))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
+			os.Exit(20)
+		}
+		for _, s := range songs {
+			fmt.Println(s.Name)
+		}
+	case conf.SplitNames:
+		if err = db.SplitSongNames(); err != nil {
+			fmt.Fprintln(os.Stderr, `Error when splitting song names:`, err.Error())
+			os.Exit(21)
+		}
+	case conf.Import:
+		sum, err := importFile(db, conf.File, songmem.ImportFormat(conf.Format))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when importing hearings:`, err.Error())
+			os.Exit(15)
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d hearings, skipped %d rows and %d duplicates.\n",
+			sum.Imported, sum.Skipped, sum.Duplicates)
+	case conf.Export:
+		w := bufio.NewWriter(os.Stdout)
+		err = db.Export(w, songmem.ExportFormat(conf.Format))
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, `Error when exporting database:`, err.Error())
+			os.Exit(16)
+		}
 	default:
-		songs, err := db.ListSongsInOrderOfLastHearing()
+		opts := queryOptions(conf, settings, 14)
+		songs, err := db.ListSongsInOrderOfLastHearingWithOptions(opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, `Error when listing songs:`, err.Error())
 			os.Exit(14)
@@ -218,6 +597,18 @@ func main() {
 	}
 }
 
+func importFile(db songmem.SongDB, filename string, format songmem.ImportFormat) (songmem.ImportSummary, error) {
+	if filename == "-" {
+		return db.Import(os.Stdin, format)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return songmem.ImportSummary{}, err
+	}
+	defer f.Close()
+	return db.Import(f, format)
+}
+
 func getDBFilename() string {
 	dataDir := os.Getenv("XDG_DATA_HOME")
 	if dataDir == "" {
@@ -231,7 +622,7 @@ func sanityCheckName(name string) {
 		fmt.Fprintln(os.Stderr, `Error: The given name is empty.`)
 		os.Exit(2)
 	}
-	if len(name) > 100 {
+	if len(name) > songmem.MaxNameLength {
 		fmt.Fprintln(os.Stderr, `Error: The given name is too long.`)
 		os.Exit(2)
 	}
@@ -240,3 +631,149 @@ func sanityCheckName(name string) {
 		os.Exit(2)
 	}
 }
+
+// queryOptions builds the options for rankings from the arguments and
+// the settings. --half-life applies to the selected ranking and takes
+// precedence over the settings. Exits with the given code, if an
+// argument cannot be parsed.
+func queryOptions(conf conf, settings settings, code int) songmem.QueryOptions {
+	opts := songmem.QueryOptions{
+		Omit:               parseDurationOrExit(conf.Omit, code),
+		Since:              parseBoundOrExit(conf.Since, code),
+		Until:              parseEndBoundOrExit(conf.Until, code),
+		Limit:              parseCountOrExit(conf.Limit, code),
+		Offset:             parseCountOrExit(conf.Offset, code),
+		FrecencyHalfLife:   settings.FrecencyHalfLife,
+		SuggestionHalfLife: settings.SuggestionHalfLife,
+	}
+	if conf.HalfLife != "" {
+		halfLife := parseDurationOrExit(conf.HalfLife, code)
+		if conf.Suggestions {
+			opts.SuggestionHalfLife = &halfLife
+		} else {
+			opts.FrecencyHalfLife = &halfLife
+		}
+	}
+	return opts
+}
+
+// suggestionOptions is like queryOptions, but also sets the options,
+// that are specific to suggestions.
+func suggestionOptions(conf conf, settings settings, code int) songmem.SuggestionOptions {
+	opts := songmem.SuggestionOptions{
+		QueryOptions: queryOptions(conf, settings, code),
+		Aggregation:  songmem.Aggregation(conf.Aggregate),
+		Direction:    songmem.Direction(conf.Direction),
+		SessionGap:   parseDurationOrExit(conf.SessionGap, code),
+	}
+	if conf.Weights != "" {
+		for _, w := range strings.Split(conf.Weights, ",") {
+			weight, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not parse weight \"%s\".\n", w)
+				os.Exit(code)
+			}
+			opts.Weights = append(opts.Weights, weight)
+		}
+	}
+	return opts
+}
+
+// sessionGap returns the session gap for the session commands. Exits
+// with the given code, if --session-gap cannot be parsed.
+func sessionGap(conf conf, settings settings, code int) time.Duration {
+	if conf.SessionGap != "" {
+		return parseDurationOrExit(conf.SessionGap, code)
+	}
+	if settings.SessionGap != 0 {
+		return settings.SessionGap
+	}
+	return songmem.DefaultSessionGap
+}
+
+// parseCountOrExit parses a non-negative number. An empty string yields
+// 0. Exits with the given code, if s cannot be parsed.
+func parseCountOrExit(s string, code int) int {
+	if s == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		fmt.Fprintf(os.Stderr, "Could not parse number \"%s\".\n", s)
+		os.Exit(code)
+	}
+	return n
+}
+
+// parseDurationOrExit parses a duration like 30m or 3d. An empty string
+// yields 0. Exits with the given code, if s cannot be parsed.
+func parseDurationOrExit(s string, code int) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := parseTimespan(s)
+	if err != nil {
+		errMsg := `Could not parse duration "` + s + `":`
+		fmt.Fprintln(os.Stderr, errMsg, err.Error())
+		os.Exit(code)
+	}
+	return d
+}
+
+func printRanking(songs []songmem.ScoredSong, scores bool) {
+	for _, s := range songs {
+		if scores {
+			fmt.Printf("%s\t%s\n", strconv.FormatFloat(s.Score, 'g', 6, 64), s.Name)
+		} else {
+			fmt.Println(s.Name)
+		}
+	}
+}
+
+// parseTimeOrExit parses an RFC3339 timestamp, a local date like
+// 2020-05-17 or a duration relative to now, like -15m. An empty string
+// yields the current time. Exits with the given code, if s cannot be
+// parsed.
+func parseTimeOrExit(s string, code int) time.Time {
+	now := time.Now()
+	if s == "" {
+		return now
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t
+	}
+	d, err := parseTimespan(s)
+	if err != nil {
+		errMsg := `Could not parse time "` + s + `":`
+		fmt.Fprintln(os.Stderr, errMsg, "expected RFC3339, a date or a duration like -15m")
+		os.Exit(code)
+	}
+	return now.Add(d)
+}
+
+// parseBoundOrExit is like parseTimeOrExit, but yields the zero time
+// for an empty string, which means no limit. Timespans without a sign,
+// like 30d, are relative to now, into the past.
+func parseBoundOrExit(s string, code int) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+") {
+		if d, err := parseTimespan(s); err == nil {
+			return time.Now().Add(-d)
+		}
+	}
+	return parseTimeOrExit(s, code)
+}
+
+// parseEndBoundOrExit is like parseBoundOrExit, but a date without a
+// time means the end of this day, so that the whole day is included.
+func parseEndBoundOrExit(s string, code int) time.Time {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return parseBoundOrExit(s, code)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/codesoap/songmem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writePlaylist writes the list of songs, that is selected by conf, as
+// a playlist to stdout. The songs are ranked with opts.
+func writePlaylist(db songmem.SongDB, conf conf, opts songmem.SuggestionOptions) (err error) {
+	songs, err := listSongsForPlaylist(db, conf, opts)
+	if err != nil {
+		return
+	}
+	return outputPlaylist(db, songs, conf)
+}
+
+// outputPlaylist writes songs as a playlist to stdout, in the format
+// and with the library given in conf. Songs are split into artist and
+// title with db's separator.
+func outputPlaylist(db songmem.SongDB, songs []string, conf conf) (err error) {
+	format := songmem.PlaylistFormat(conf.Format)
+	if conf.Format == "" {
+		format = songmem.M3U8
+	}
+	libDir := conf.Library
+	if libDir == "" {
+		libDir = getMusicDir()
+	}
+	lib, err := songmem.ScanMusicLibrary(libDir, db.Separator)
+	if err != nil {
+		if format == songmem.M3U8 {
+			return fmt.Errorf("could not scan music library: %v", err)
+		}
+		// XSPF playlists are still useful without file locations.
+		lib, err = nil, nil
+	} else {
+		for _, err := range lib.Skipped {
+			fmt.Fprintln(os.Stderr, "Skipped unreadable file:", err)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	unresolved, err := songmem.WritePlaylist(w, songs, format, lib, db.Separator)
+	if err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	for _, song := range unresolved {
+		fmt.Fprintln(os.Stderr, "Could not find file of:", song)
+	}
+	return
+}
+
+func listSongsForPlaylist(db songmem.SongDB, conf conf, opts songmem.SuggestionOptions) (names []string, err error) {
+	var songs []songmem.ScoredSong
+	switch {
+	case conf.AddedAt:
+		return db.ListSongsInOrderOfAdditionWithOptions(opts.QueryOptions)
+	case conf.Favourite:
+		songs, err = db.RankFavourites(opts.QueryOptions)
+	case conf.Frecent:
+		songs, err = db.RankFrecentSongs(opts.QueryOptions)
+	case conf.Suggestions:
+		songs, err = db.RankSuggestionsForSeeds(conf.Seed, opts)
+	default:
+		return db.ListSongsInOrderOfLastHearingWithOptions(opts.QueryOptions)
+	}
+	for _, s := range songs {
+		names = append(names, s.Name)
+	}
+	return
+}
+
+func getMusicDir() string {
+	musicDir := os.Getenv("XDG_MUSIC_DIR")
+	if musicDir == "" {
+		musicDir = filepath.Join(os.Getenv("HOME"), "Music")
+	}
+	return musicDir
+}
+
+// writeAutoqueue writes a queue, that follows conf.SeedSong, as a
+// playlist to stdout.
+func writeAutoqueue(db songmem.SongDB, conf conf, gap time.Duration) error {
+	length, err := strconv.Atoi(conf.Length)
+	if err != nil {
+		return fmt.Errorf(`invalid length "%s"`, conf.Length)
+	}
+	temperature, err := strconv.ParseFloat(conf.Temperature, 64)
+	if err != nil {
+		return fmt.Errorf(`invalid temperature "%s"`, conf.Temperature)
+	}
+	opts := songmem.AutoqueueOptions{
+		Omit:        parseDurationOrExit(conf.Omit, 25),
+		Temperature: temperature,
+		SecondOrder: conf.SecondOrder,
+		SessionGap:  gap,
+	}
+	songs, err := db.Autoqueue(strings.TrimSpace(conf.SeedSong), length, opts)
+	if err != nil {
+		return err
+	}
+	return outputPlaylist(db, songs, conf)
+}
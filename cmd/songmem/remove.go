@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codesoap/songmem"
+	"os"
+	"time"
+)
+
+// removeSong removes the song conf.Name or, if it is empty, the last
+// added song. With --cascade, its hearings are removed too. With
+// --dry-run, the song and its hearings are only listed.
+func removeSong(db songmem.SongDB, conf conf) (err error) {
+	song := conf.Name
+	if song == "" && !conf.Cascade && !conf.DryRun {
+		if song, err = db.RemoveLastAddedSong(); err == nil {
+			fmt.Fprintln(os.Stderr, "Removed song:", song)
+		}
+		return
+	}
+	if song == "" {
+		if song, err = db.LastAddedSong(); err != nil {
+			return
+		}
+	}
+	if conf.DryRun {
+		hearings, err := db.ListHearings(songmem.HearingFilter{Song: song})
+		if err != nil {
+			return err
+		}
+		if len(hearings) > 0 && !conf.Cascade {
+			return fmt.Errorf("there are still %d hearings of the song", len(hearings))
+		}
+		printHearings(hearings)
+		fmt.Fprintf(os.Stderr, "Would remove song %s with %d hearings.\n", song, len(hearings))
+		return nil
+	}
+	var opts []songmem.RemoveOption
+	if conf.Cascade {
+		opts = append(opts, songmem.Cascade)
+	}
+	if err = db.RemoveSong(song, opts...); err != nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Removed song:", song)
+	return
+}
+
+// removeHearings removes the hearings between conf.From and conf.To. If
+// conf.Name is given, only its hearings are removed. With --dry-run,
+// the hearings are only listed.
+func removeHearings(db songmem.SongDB, conf conf) error {
+	filter := songmem.HearingFilter{
+		Song:  conf.Name,
+		Since: parseBoundOrExit(conf.From, 33),
+		Until: parseEndBoundOrExit(conf.To, 33),
+	}
+	if filter == (songmem.HearingFilter{}) {
+		return errors.New("give a song, --from or --to")
+	}
+	if conf.DryRun {
+		hearings, err := db.ListHearings(filter)
+		if err != nil {
+			return err
+		}
+		printHearings(hearings)
+		fmt.Fprintf(os.Stderr, "Would remove %d hearings.\n", len(hearings))
+		return nil
+	}
+	removed, err := db.RemoveHearings(filter)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Removed %d hearings.\n", removed)
+	return nil
+}
+
+// printHearings prints the time of each hearing, followed by a tab and
+// the song.
+func printHearings(hearings []songmem.Hearing) {
+	for _, h := range hearings {
+		fmt.Printf("%s\t%s\n", h.HeardAt.Format(time.RFC3339), h.Song)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codesoap/songmem"
+	"os"
+	"strings"
+)
+
+// didYouMeanCount is the number of similarly named songs, that are
+// offered, when a song is not found.
+const didYouMeanCount = 5
+
+// printSearch prints the songs, that match the query in conf, best
+// matches first.
+func printSearch(db songmem.SongDB, conf conf) error {
+	opts := songmem.SearchOptions{
+		Limit:  parseCountOrExit(conf.Limit, 29),
+		Offset: parseCountOrExit(conf.Offset, 29),
+	}
+	songs, err := db.SearchSongs(strings.Join(conf.Query, " "), opts)
+	if err != nil {
+		return err
+	}
+	printRanking(songs, conf.Scores)
+	return nil
+}
+
+// printDidYouMean prints the songs, that are named most like the given
+// names, to stderr, if err means, that a song was not found. Names of
+// existing songs are skipped.
+func printDidYouMean(db songmem.SongDB, err error, names ...string) {
+	if !errors.Is(err, songmem.ErrSongNotFound) {
+		return
+	}
+	for _, name := range names {
+		opts := songmem.SearchOptions{Limit: didYouMeanCount}
+		songs, err := db.SearchSongs(name, opts)
+		if err != nil || len(songs) == 0 || songs[0].Name == name {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Did you mean one of these instead of \"%s\"?\n", name)
+		for _, s := range songs {
+			fmt.Fprintln(os.Stderr, "   ", s.Name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codesoap/songmem"
+	"strconv"
+	"time"
+)
+
+// printSessions prints the listening sessions, that started between
+// conf.From and conf.To, newest first. Sessions are numbered, counting
+// back from the latest session, so that the numbers can be passed to
+// replay-session.
+func printSessions(db songmem.SongDB, conf conf, gap time.Duration) error {
+	sessions, err := db.ListSessionsWithOptions(songmem.SessionOptions{
+		Gap:         gap,
+		From:        parseBoundOrExit(conf.From, 23),
+		To:          parseEndBoundOrExit(conf.To, 23),
+		NewestFirst: true,
+		Limit:       parseCountOrExit(conf.Limit, 23),
+		Offset:      parseCountOrExit(conf.Offset, 23),
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		fmt.Printf("Session %d: %s to %s\n", s.Number,
+			s.Start.Format("2006-01-02 15:04"), s.End.Format("2006-01-02 15:04"))
+		for _, song := range s.Songs {
+			fmt.Printf("\t%s\n", song)
+		}
+	}
+	return nil
+}
+
+// replaySession writes the songs of the conf.N-th latest session as a
+// playlist to stdout.
+func replaySession(db songmem.SongDB, conf conf, gap time.Duration) error {
+	n, err := strconv.Atoi(conf.N)
+	if err != nil || n < 1 {
+		return fmt.Errorf(`invalid session number "%s"`, conf.N)
+	}
+	sessions, err := db.ListSessionsWithOptions(songmem.SessionOptions{
+		Gap:         gap,
+		NewestFirst: true,
+		Offset:      n - 1,
+		Limit:       1,
+	})
+	if err != nil {
+		return err
+	} else if len(sessions) == 0 {
+		return fmt.Errorf("there are fewer than %d sessions", n)
+	}
+	return outputPlaylist(db, sessions[0].Songs, conf)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/codesoap/songmem"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// histogramWidth is the length of the longest bar of a histogram.
+const histogramWidth = 40
+
+// printStats prints the statistics about the hearings between conf.From
+// and conf.To, in the format given by conf.Format.
+func printStats(db songmem.SongDB, conf conf) (err error) {
+	from := parseBoundOrExit(conf.From, 27)
+	to := parseEndBoundOrExit(conf.To, 27)
+	stats, err := db.Stats(from, to)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	switch conf.Format {
+	case "", "text":
+		writeStatsText(w, stats)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(stats)
+	default:
+		return fmt.Errorf("unknown stats format '%s'", conf.Format)
+	}
+	if err != nil {
+		return
+	}
+	return w.Flush()
+}
+
+func writeStatsText(w io.Writer, stats songmem.Stats) {
+	fmt.Fprintf(w, "Hearings:       %d\n", stats.Hearings)
+	fmt.Fprintf(w, "Distinct songs: %d\n", stats.DistinctSongs)
+	fmt.Fprintf(w, "New songs:      %d\n", stats.NewSongs)
+	if s := stats.LongestStreak; s.Days > 0 {
+		fmt.Fprintf(w, "Longest streak: %d days, %s to %s\n", s.Days, s.Start, s.End)
+	}
+	if d := stats.BusiestDay; d.Hearings > 0 {
+		fmt.Fprintf(w, "Busiest day:    %s, %d hearings\n", d.Name, d.Hearings)
+	}
+
+	fmt.Fprintln(w, "\nTop songs:")
+	writeCounts(w, stats.TopSongs)
+	fmt.Fprintln(w, "\nTop artists:")
+	writeCounts(w, stats.TopArtists)
+
+	fmt.Fprintln(w, "\nHearings per weekday:")
+	var labels []string
+	var values []int
+	// Weeks start on Monday here.
+	for i := 1; i <= 7; i++ {
+		labels = append(labels, time.Weekday(i % 7).String()[:3])
+		values = append(values, stats.HearingsPerWeekday[i%7])
+	}
+	writeHistogram(w, labels, values)
+
+	fmt.Fprintln(w, "\nHearings per hour:")
+	labels, values = nil, nil
+	for hour, n := range stats.HearingsPerHour {
+		labels = append(labels, fmt.Sprintf("%02d", hour))
+		values = append(values, n)
+	}
+	writeHistogram(w, labels, values)
+}
+
+func writeCounts(w io.Writer, counts []songmem.Count) {
+	for i, c := range counts {
+		fmt.Fprintf(w, "%3d. %s (%d)\n", i+1, c.Name, c.Hearings)
+	}
+}
+
+// writeHistogram writes a bar for each value, scaled so that the
+// largest value has a bar of histogramWidth.
+func writeHistogram(w io.Writer, labels []string, values []int) {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	for i, v := range values {
+		bar := 0
+		if max > 0 {
+			bar = (v*histogramWidth + max - 1) / max
+		}
+		line := fmt.Sprintf("%s %6d %s", labels[i], v, strings.Repeat("#", bar))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// writeYearInReview writes the review of conf.Year, or the current
+// year, to stdout, in the format given by conf.Format.
+func writeYearInReview(db songmem.SongDB, conf conf) (err error) {
+	year := time.Now().Year()
+	if conf.Year != "" {
+		if year, err = strconv.Atoi(conf.Year); err != nil {
+			return fmt.Errorf(`invalid year "%s"`, conf.Year)
+		}
+	}
+	format := songmem.ReportFormat(conf.Format)
+	if conf.Format == "" {
+		format = songmem.Markdown
+	}
+	review, err := db.YearInReview(year)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if err = review.WriteReport(w, format); err != nil {
+		return
+	}
+	return w.Flush()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/codesoap/songmem"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchMPD registers the songs played by MPD, until songmem receives
+// SIGINT or SIGTERM.
+func watchMPD(db songmem.SongDB, conf conf) error {
+	host, port := conf.Host, conf.Port
+	if host == "" {
+		host = os.Getenv("MPD_HOST")
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = os.Getenv("MPD_PORT")
+	}
+	if port == "" {
+		port = "6600"
+	}
+	var password string
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		password, host = host[:i], host[i+1:]
+	}
+
+	w := songmem.NewMPDWatcher(db, net.JoinHostPort(host, port))
+	w.Password = password
+	var err error
+	if w.MinShare, err = strconv.ParseFloat(conf.MinShare, 64); err != nil ||
+		w.MinShare < 0 || w.MinShare > 1 {
+		return fmt.Errorf(`invalid share "%s"; expected a number from 0 to 1`, conf.MinShare)
+	}
+	if w.MinTime, err = time.ParseDuration(conf.MinTime); err != nil || w.MinTime < 0 {
+		return fmt.Errorf(`invalid timespan "%s"`, conf.MinTime)
+	}
+	w.Logf = func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+	if err = w.Watch(ctx); err == context.Canceled {
+		return nil
+	}
+	return err
+}
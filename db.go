@@ -4,11 +4,33 @@ import (
 	"database/sql"
 	"errors"
 	sqlite3 "github.com/mattn/go-sqlite3"
+	"math"
 	"time"
 )
 
 type SongDB struct {
 	*sql.DB
+
+	// Separator separates the artist from the title in song names. It
+	// is used to fill the artist and title of songs, that are added.
+	Separator string
+
+	path string
+}
+
+// DefaultSeparator is the separator in song names like
+// "<artist> - <title>".
+const DefaultSeparator = " - "
+
+// MaxNameLength is the maximum length of song names in bytes.
+const MaxNameLength = 100
+
+// execQueryer is implemented by *sql.DB and *sql.Tx, so that queries
+// can be shared between standalone calls and transactions.
+type execQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 type songHearing struct {
@@ -16,6 +38,10 @@ type songHearing struct {
 	Date time.Time
 }
 
+// InitDB opens the database at filepath. Fails if the database was
+// created by a newer version of songmem.
+//
+// Call Migrate afterwards, to create or update the schema.
 func InitDB(filepath string) (SongDB, error) {
 	db, err := sql.Open("sqlite3", filepath)
 	if err == nil {
@@ -25,12 +51,26 @@ func InitDB(filepath string) (SongDB, error) {
 			_, err = db.Exec(`PRAGMA foreign_keys = ON`)
 		}
 	}
-	return SongDB{db}, err
+	songDB := SongDB{DB: db, Separator: DefaultSeparator, path: filepath}
+	if err == nil {
+		err = songDB.checkSchemaVersion()
+	}
+	return songDB, err
 }
 
+// CreateSchemaIfNotExists creates or updates the schema of the
+// database. It is the same as Migrate.
 func (db SongDB) CreateSchemaIfNotExists() (err error) {
+	_, err = db.Migrate()
+	return
+}
+
+func createBaseSchema(db SongDB, tx *sql.Tx) (err error) {
 	// id is explicitly used instead of rowid, so that AUTOINCREMENT can be set.
 	// This ensures, that one can, for example, delete the last added hearing.
+	//
+	// IF NOT EXISTS is used, because databases, that were created before
+	// the schema was versioned, already contain these tables.
 	commands := [...]string{
 		`CREATE TABLE IF NOT EXISTS song(
 		     id      INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -44,19 +84,14 @@ func (db SongDB) CreateSchemaIfNotExists() (err error) {
 		     songID  INTEGER NOT NULL,
 		     heardAt TEXT NOT NULL,
 		     FOREIGN KEY(songID) REFERENCES song(id)
-		 )`}
-
-	tx, err := db.Begin()
-	defer tx.Rollback()
-	if err != nil {
-		return
-	}
+		 )`,
+		`CREATE INDEX IF NOT EXISTS hearing_songID ON hearing(songID)`}
 	for _, c := range commands {
 		if _, err = tx.Exec(c); err != nil {
 			return
 		}
 	}
-	return tx.Commit()
+	return
 }
 
 // AddSong adds the song with the given name and the current timestamp
@@ -68,12 +103,32 @@ func (db SongDB) CreateSchemaIfNotExists() (err error) {
 // enable sorting songs by time of day, even when traveling around
 // timezones.
 func (db SongDB) AddSong(song string) (err error) {
-	if len(song) == 0 {
+	return db.AddSongAt(song, time.Now())
+}
+
+// AddSongAt adds the song with the given name and the given timestamp
+// to the database.
+//
+// The timestamp will be stored with the timezone of t.
+//
+// The artist and title of the song are taken from its name, if it
+// contains the database's separator.
+func (db SongDB) AddSongAt(song string, t time.Time) (err error) {
+	return addSongAt(db, db.songFromName(song), t)
+}
+
+func addSongAt(e execQueryer, song Song, t time.Time) (err error) {
+	if len(song.Name) == 0 {
 		return errors.New("the given song is empty")
 	}
-	t := time.Now().Format(time.RFC3339)
-	_, err = db.Exec(`INSERT INTO song(name, addedAt)
-	                  VALUES (?, ?)`, song, t)
+	if _, isAlias, err := aliasSongID(e, song.Name); err != nil {
+		return err
+	} else if isAlias {
+		return errors.New("the name is an alias of another song")
+	}
+	_, err = e.Exec(`INSERT INTO song(name, artist, title, album, addedAt, addedAtUnix)
+	                 VALUES (?, ?, ?, ?, ?, ?)`, song.Name, nullString(song.Artist),
+		nullString(song.Title), nullString(song.Album), t.Format(time.RFC3339), t.Unix())
 	return
 }
 
@@ -86,24 +141,64 @@ func (db SongDB) AddSong(song string) (err error) {
 // enable sorting hearings by time of day, even when traveling around
 // timezones.
 func (db SongDB) AddHearing(song string) (err error) {
+	return db.AddHearingAt(song, time.Now())
+}
+
+// AddHearingAt registers that the given song was listened to at the
+// given timestamp. Hearings do not need to be added in chronological
+// order, so t may be older than already registered hearings.
+//
+// song must exactly match an already existing song or alias from the
+// database; otherwise ErrSongNotFound is returned.
+//
+// The timestamp will be stored with the timezone of t.
+func (db SongDB) AddHearingAt(song string, t time.Time) (err error) {
+	return addHearingAt(db, song, t)
+}
+
+func addHearingAt(e execQueryer, song string, t time.Time) (err error) {
 	if len(song) == 0 {
 		return errors.New("the given song is empty")
 	}
-	t := time.Now().Format(time.RFC3339)
-	_, err = db.Exec(`INSERT INTO hearing(songID, heardAt)
-	                  VALUES (
-	                      (SELECT id FROM song WHERE name = ? COLLATE NOCASE), ?
-	                  )`, song, t)
+	if song, err = resolveAlias(e, song); err != nil {
+		return
+	}
+	_, err = e.Exec(`INSERT INTO hearing(songID, heardAt, heardAtUnix)
+	                 VALUES (
+	                     (SELECT id FROM song WHERE name = ? COLLATE NOCASE), ?, ?
+	                 )`, song, t.Format(time.RFC3339), t.Unix())
+	// songID is NULL, if the song does not exist.
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintNotNull {
+		err = ErrSongNotFound
+	}
 	return
 }
 
 // AddHearingAndSongIfNeeded registers that the song was listened to
 // and, if necessary, adds the song to the database before that.
 func (db SongDB) AddHearingAndSongIfNeeded(song string) error {
-	if len(song) == 0 {
+	return db.AddHearingAndSongIfNeededAt(song, time.Now())
+}
+
+// AddHearingAndSongIfNeededAt registers that the song was listened to
+// at the given timestamp and, if necessary, adds the song to the
+// database before that. If song is an alias, the hearing is registered
+// for the song it names.
+func (db SongDB) AddHearingAndSongIfNeededAt(song string, t time.Time) error {
+	return addHearingAndSongIfNeededAt(db, db.songFromName(song), t)
+}
+
+func addHearingAndSongIfNeededAt(e execQueryer, song Song, t time.Time) error {
+	if len(song.Name) == 0 {
 		return errors.New("the given song is empty")
 	}
-	err := db.AddSong(song)
+	name, err := resolveAlias(e, song.Name)
+	if err != nil {
+		return err
+	} else if name != song.Name {
+		return addHearingAt(e, name, t)
+	}
+	err = addSongAt(e, song, t)
 	if err != nil {
 		// The sqlite3.ErrConstraintUnique just indicates, that the song
 		// is already in the database.
@@ -112,13 +207,32 @@ func (db SongDB) AddHearingAndSongIfNeeded(song string) error {
 			return err
 		}
 	}
-	return db.AddHearing(song)
+	return addHearingAt(e, song.Name, t)
 }
 
 // ListSongsInOrderOfAddition lists all songs in the order they were
 // added. Newest additions will be listed first.
 func (db SongDB) ListSongsInOrderOfAddition() (songs []string, err error) {
-	rows, err := db.Query(`SELECT name FROM song ORDER BY id DESC`)
+	return db.ListSongsInOrderOfAdditionWithOptions(QueryOptions{})
+}
+
+// ListSongsInOrderOfAdditionWithOptions lists the songs, that were
+// added between opts.Since and opts.Until, in the order they were
+// added. Newest additions will be listed first.
+func (db SongDB) ListSongsInOrderOfAdditionWithOptions(opts QueryOptions) (songs []string, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	since, until := opts.bounds()
+	limit, offset := opts.sqlLimit()
+	rows, err := db.Query(`SELECT name FROM song
+	                       WHERE addedAtUnix BETWEEN ? AND ?
+	                       AND id NOT IN (
+	                           SELECT songID FROM hearing WHERE heardAtUnix > ?
+	                       )
+	                       ORDER BY id DESC
+	                       LIMIT ? OFFSET ?`,
+		since, until, omitDeadline(opts.Omit), limit, offset)
 	if err != nil {
 		return
 	}
@@ -128,14 +242,33 @@ func (db SongDB) ListSongsInOrderOfAddition() (songs []string, err error) {
 // ListSongsInOrderOfLastHearing lists all songs in the order they were
 // last heard. The songs that were heard last will be listed first.
 func (db SongDB) ListSongsInOrderOfLastHearing() (songs []string, err error) {
+	return db.ListSongsInOrderOfLastHearingWithOptions(QueryOptions{})
+}
+
+// ListSongsInOrderOfLastHearingWithOptions lists the songs, that were
+// heard between opts.Since and opts.Until, in the order they were last
+// heard in this period. The songs that were heard last will be listed
+// first.
+func (db SongDB) ListSongsInOrderOfLastHearingWithOptions(opts QueryOptions) (songs []string, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	since, until := opts.bounds()
+	limit, offset := opts.sqlLimit()
 	rows, err := db.Query(`SELECT name
 	                       FROM (
-	                           SELECT songID, MAX(heardAt) heardAt
+	                           SELECT songID, MAX(heardAtUnix) heardAtUnix
 	                           FROM hearing
+	                           WHERE heardAtUnix BETWEEN ? AND ?
 	                           GROUP BY (songID)
 	                       ) sub
 	                       INNER JOIN song ON song.id = sub.songID
-	                       ORDER BY sub.heardAt DESC`)
+	                       WHERE sub.songID NOT IN (
+	                           SELECT songID FROM hearing WHERE heardAtUnix > ?
+	                       )
+	                       ORDER BY sub.heardAtUnix DESC
+	                       LIMIT ? OFFSET ?`,
+		since, until, omitDeadline(opts.Omit), limit, offset)
 	if err != nil {
 		return
 	}
@@ -152,23 +285,50 @@ func (db SongDB) ListFavouriteSongs() (songs []string, err error) {
 // you heard most often. Songs that were heard within the omit timespan
 // before now are not listed.
 func (db SongDB) ListFavouriteSongsOmitting(omit time.Duration) (songs []string, err error) {
-	// FIXME: MAX() is not quite right, because of timezones.
-	rows, err := db.Query(`SELECT name, MAX(heardAt) FROM hearing
-	                       INNER JOIN song ON song.id = hearing.songID
-	                       GROUP BY hearing.songID
-	                       ORDER BY COUNT(*) DESC`)
-	if err != nil {
+	scoredSongs, err := db.RankFavourites(QueryOptions{Omit: omit})
+	return scoredSongsToNames(scoredSongs), err
+}
+
+// RankFavourites ranks songs by how often you heard them. The score is
+// the number of hearings. Only hearings between opts.Since and
+// opts.Until are counted.
+func (db SongDB) RankFavourites(opts QueryOptions) (songs []ScoredSong, err error) {
+	if err = opts.Validate(); err != nil {
 		return
 	}
-	shs, err := rowsToSongHearings(rows, "", omit)
+	since, until := opts.bounds()
+	limit, offset := opts.sqlLimit()
+	// SQLite takes heardAt from the row with the maximum heardAtUnix.
+	rows, err := db.Query(`SELECT name, COUNT(*), heardAt, MAX(heardAtUnix)
+	                       FROM hearing
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       WHERE heardAtUnix BETWEEN ? AND ?
+	                       AND hearing.songID NOT IN (
+	                           SELECT songID FROM hearing WHERE heardAtUnix > ?
+	                       )
+	                       GROUP BY hearing.songID
+	                       ORDER BY COUNT(*) DESC, name
+	                       LIMIT ? OFFSET ?`,
+		since, until, omitDeadline(opts.Omit), limit, offset)
 	if err != nil {
 		return
 	}
-	songs = make([]string, len(shs))
-	for i := range shs {
-		songs[i] = shs[i].Name
+	defer rows.Close()
+	for rows.Next() {
+		var s ScoredSong
+		var lastHeard string
+		var lastHeardUnix int64
+		err = rows.Scan(&s.Name, &s.HearingCount, &lastHeard, &lastHeardUnix)
+		if err != nil {
+			return
+		}
+		if s.LastHeard, err = time.Parse(time.RFC3339, lastHeard); err != nil {
+			return
+		}
+		s.Score = float64(s.HearingCount)
+		songs = append(songs, s)
 	}
-	return
+	return songs, rows.Err()
 }
 
 func extractSongs(nameRows *sql.Rows) (songs []string, err error) {
@@ -191,18 +351,23 @@ func (db SongDB) ListFrecentSongs() (songs []string, err error) {
 // frecent first. Songs that were heard within the omit timespan before
 // now are not listed.
 func (db SongDB) ListFrecentSongsOmitting(omit time.Duration) (songs []string, err error) {
-	// FIXME: If performance becomes an issue: limit results to last year,
-	//        or so.
-	rows, err := db.Query(`SELECT name, heardAt FROM hearing
-	                       INNER JOIN song ON song.id = hearing.songID`)
-	if err != nil {
+	scoredSongs, err := db.RankFrecentSongs(QueryOptions{Omit: omit})
+	return scoredSongsToNames(scoredSongs), err
+}
+
+// RankFrecentSongs ranks songs by their frecency. The score is the sum
+// of all hearings of the song, weighted by their age.
+func (db SongDB) RankFrecentSongs(opts QueryOptions) (songs []ScoredSong, err error) {
+	if err = opts.Validate(); err != nil {
 		return
 	}
-	shs, err := rowsToSongHearings(rows, "", omit)
+	// FIXME: If performance becomes an issue: limit results to last year,
+	//        or so.
+	shs, err := db.querySongHearings(opts)
 	if err != nil {
 		return
 	}
-	return songHearingsToFrecentSongs(shs), nil
+	return songHearingsToFrecentSongs(shs, opts), nil
 }
 
 // ListSuggestions lists songs that you aften hear before or after
@@ -215,22 +380,49 @@ func (db SongDB) ListSuggestions(song string) (songs []string, err error) {
 // after hearing the given song. Songs that were heard within the omit
 // timespan before now are not listed. Best suggestions first.
 func (db SongDB) ListSuggestionsOmitting(song string, omit time.Duration) (songs []string, err error) {
-	rows, err := db.Query(`SELECT name, heardAt FROM hearing
-	                       INNER JOIN song ON song.id = hearing.songID`)
-	if err != nil {
-		return
+	scoredSongs, err := db.RankSuggestions(song, QueryOptions{Omit: omit})
+	return scoredSongsToNames(scoredSongs), err
+}
+
+// RankSuggestions ranks songs by how often you hear them before or
+// after hearing the given song. The score is the correlation of the
+// hearings. Songs, that were never heard within 16 half-lives of a
+// hearing of the given song, are not ranked.
+func (db SongDB) RankSuggestions(song string, opts QueryOptions) (songs []ScoredSong, err error) {
+	return db.RankSuggestionsForSeeds([]string{song}, SuggestionOptions{QueryOptions: opts})
+}
+
+// omitDeadline returns the unix time, after which songs must not have
+// been heard, to not be omitted.
+func omitDeadline(omit time.Duration) int64 {
+	if omit <= 0 {
+		return math.MaxInt64
 	}
-	shs, err := rowsToSongHearings(rows, song, omit)
+	return time.Now().Add(-omit).Unix()
+}
+
+// querySongHearings returns all hearings between opts.Since and
+// opts.Until, except those of songs, that were heard within the omit
+// timespan before now.
+func (db SongDB) querySongHearings(opts QueryOptions) (shs []songHearing, err error) {
+	since, until := opts.bounds()
+	rows, err := db.Query(`SELECT name, heardAt FROM hearing
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       WHERE heardAtUnix BETWEEN ? AND ?
+	                       AND hearing.songID NOT IN (
+	                           SELECT songID FROM hearing WHERE heardAtUnix > ?
+	                       )`, since, until, omitDeadline(opts.Omit))
 	if err != nil {
 		return
 	}
-	return songHearingsToSuggestions(shs, song)
+	return rowsToSongHearings(rows)
 }
 
-func rowsToSongHearings(rows *sql.Rows, ref string, omit time.Duration) (shs []songHearing, err error) {
-	deadline := time.Now().Add(-omit)
-	unwantedSongs := make(map[string]bool)
-	unfilteredSHS := make([]songHearing, 0)
+// rowsToSongHearings scans rows of names and hearing timestamps. The
+// timestamps keep their original timezone, so that the local time of
+// day of the hearing is known.
+func rowsToSongHearings(rows *sql.Rows) (shs []songHearing, err error) {
+	defer rows.Close()
 	for rows.Next() {
 		var name string
 		var dateStr string
@@ -241,22 +433,16 @@ func rowsToSongHearings(rows *sql.Rows, ref string, omit time.Duration) (shs []s
 		if date, err = time.Parse(time.RFC3339, dateStr); err != nil {
 			return
 		}
-		if name != ref && date.After(deadline) {
-			unwantedSongs[name] = true
-		} else {
-			unfilteredSHS = append(unfilteredSHS, songHearing{name, date})
-		}
+		shs = append(shs, songHearing{name, date})
 	}
-	for _, sh := range unfilteredSHS {
-		if _, unwanted := unwantedSongs[sh.Name]; !unwanted {
-			shs = append(shs, sh)
-		}
-	}
-	return
+	return shs, rows.Err()
 }
 
-// RemoveLastHearing removes the latest hearing. Fails if there is no
-// hearing in the database.
+// RemoveLastHearing removes the hearing, that was registered last.
+// Fails if there is no hearing in the database.
+//
+// This is not necessarily the hearing with the most recent timestamp,
+// so that a mistakenly backfilled hearing can be undone, too.
 func (db SongDB) RemoveLastHearing() (song string, err error) {
 	rows, err := db.Query(`SELECT hearing.id, name FROM hearing
 	                       INNER JOIN song ON hearing.songID = song.id
@@ -290,9 +476,14 @@ func (db SongDB) RemoveLastHearing() (song string, err error) {
 	return
 }
 
-// RemoveLastHearingOf removes the latest hearing of the given song.
-// Fails if the song was never heard or the song does not exist.
+// RemoveLastHearingOf removes the hearing of the given song, that was
+// registered last. Fails if the song was never heard. Returns
+// ErrSongNotFound, if the song does not exist. Like when registering
+// hearings, song may be an alias and its case does not matter.
 func (db SongDB) RemoveLastHearingOf(song string) (err error) {
+	if song, err = resolveAlias(db, song); err != nil {
+		return
+	}
 	r, err := db.Exec(`DELETE FROM hearing WHERE id = (
 	                       SELECT hearing.id from hearing
 	                       INNER JOIN song ON hearing.songID = song.id
@@ -308,25 +499,63 @@ func (db SongDB) RemoveLastHearingOf(song string) (err error) {
 		return
 	}
 	if n != 1 {
-		err = errors.New("no hearing for the song was found")
+		if _, err = songID(db, song); err == nil {
+			err = errors.New("no hearing for the song was found")
+		}
 	}
 	return
 }
 
+// RemoveOption changes how songs are removed.
+type RemoveOption int
+
+const (
+	// Cascade removes the hearings of a song together with it.
+	Cascade RemoveOption = iota + 1
+)
+
 // RemoveSong removes the song with the given name from the database.
 // Fails if there is still an entry in the hearing table, that
-// references the song.
-func (db SongDB) RemoveSong(song string) (err error) {
-	r, err := db.Exec(`DELETE FROM song WHERE name = ?`, song)
+// references the song, unless the Cascade option is given. Returns
+// ErrSongNotFound, if there is no such song.
+//
+// Use ListHearings to see which hearings would be removed with Cascade.
+func (db SongDB) RemoveSong(song string, opts ...RemoveOption) (err error) {
+	cascade := false
+	for _, opt := range opts {
+		cascade = cascade || opt == Cascade
+	}
+	tx, err := db.Begin()
 	if err != nil {
 		return
 	}
-	n, err := r.RowsAffected()
+	defer tx.Rollback()
+	id, err := songID(tx, song)
 	if err != nil {
 		return
 	}
-	if n != 1 {
-		err = errors.New("song not found")
+	if cascade {
+		if _, err = tx.Exec(`DELETE FROM hearing WHERE songID = ?`, id); err != nil {
+			return
+		}
+	}
+	if _, err = tx.Exec(`DELETE FROM song WHERE id = ?`, id); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// LastAddedSong returns the name of the song, that was added last.
+// This is the song, that RemoveLastAddedSong would remove.
+func (db SongDB) LastAddedSong() (song string, err error) {
+	_, song, err = lastAddedSong(db)
+	return
+}
+
+func lastAddedSong(e execQueryer) (id int64, song string, err error) {
+	err = e.QueryRow(`SELECT id, name FROM song ORDER BY id DESC LIMIT 1`).Scan(&id, &song)
+	if err == sql.ErrNoRows {
+		err = errors.New("no song found")
 	}
 	return
 }
@@ -337,21 +566,10 @@ func (db SongDB) RemoveSong(song string) (err error) {
 //
 // Returns the removed song's name.
 func (db SongDB) RemoveLastAddedSong() (song string, err error) {
-	rows, err := db.Query(`SELECT id, name FROM song ORDER BY id DESC LIMIT 1`)
+	id, song, err := lastAddedSong(db)
 	if err != nil {
 		return
 	}
-	if rows.Next() == false {
-		return "", errors.New("no song found")
-	}
-	var id int64
-	if err = rows.Scan(&id, &song); err != nil {
-		return
-	}
-	if err = rows.Close(); err != nil {
-		return
-	}
-
 	r, err := db.Exec(`DELETE FROM song WHERE id = ?`, id)
 	if err != nil {
 		return
@@ -366,21 +584,63 @@ func (db SongDB) RemoveLastAddedSong() (song string, err error) {
 	return
 }
 
-// RenameSong renames the given song to newName.
+// RenameSong renames the given song to newName. The artist and title
+// of the song are taken from the new name. Returns ErrSongNotFound,
+// if there is no such song. Fails if there already is a song named
+// newName; use MergeSongs to combine them. Also fails, if newName is an
+// alias of another song; if it is an alias of the renamed song, the
+// alias is removed.
 func (db SongDB) RenameSong(song, newName string) (err error) {
 	if len(newName) == 0 {
 		return errors.New("the new name is empty")
 	}
-	r, err := db.Exec(`UPDATE song SET name = ? WHERE name = ?;`, newName, song)
+	tx, err := db.Begin()
 	if err != nil {
 		return
 	}
-	n, err := r.RowsAffected()
+	defer tx.Rollback()
+	id, err := songID(tx, song)
 	if err != nil {
 		return
 	}
-	if n != 1 {
-		err = errors.New("song not found")
+	aliasOf, isAlias, err := aliasSongID(tx, newName)
+	if err != nil {
+		return
+	} else if isAlias && aliasOf != id {
+		return errors.New("the new name is an alias of another song")
+	} else if isAlias {
+		_, err = tx.Exec(`DELETE FROM alias WHERE name = ? COLLATE NOCASE`, newName)
+		if err != nil {
+			return
+		}
+	}
+	s := db.songFromName(newName)
+	_, err = tx.Exec(`UPDATE song SET name = ?, artist = ?, title = ?
+	                  WHERE id = ?`,
+		newName, nullString(s.Artist), nullString(s.Title), id)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return errors.New("a song with the new name already exists; merge the songs instead")
+	}
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// addUnixTimestamps adds columns, that store the timestamps as unix
+// time. The original timestamps keep the local timezone of when they
+// were registered, so they cannot be compared as strings.
+func addUnixTimestamps(db SongDB, tx *sql.Tx) (err error) {
+	commands := [...]string{
+		`ALTER TABLE song ADD COLUMN addedAtUnix INTEGER`,
+		`UPDATE song SET addedAtUnix = CAST(strftime('%s', addedAt) AS INTEGER)`,
+		`ALTER TABLE hearing ADD COLUMN heardAtUnix INTEGER`,
+		`UPDATE hearing SET heardAtUnix = CAST(strftime('%s', heardAt) AS INTEGER)`,
+		`CREATE INDEX hearing_heardAtUnix ON hearing(heardAtUnix)`}
+	for _, c := range commands {
+		if _, err = tx.Exec(c); err != nil {
+			return
+		}
 	}
 	return
 }
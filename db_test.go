@@ -0,0 +1,240 @@
+package songmem
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestDB creates a database with the schema in a temporary
+// directory. The returned function closes the database and removes the
+// directory.
+func newTestDB(t testing.TB) (SongDB, func()) {
+	dir, err := ioutil.TempDir("", "songmem")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	db, err := InitDB(filepath.Join(dir, "songmem.sql"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Could not initialize database: %v", err)
+	}
+	if err = db.CreateSchemaIfNotExists(); err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		t.Fatalf("Could not create schema: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// addHearings adds the hearings and their songs to db.
+func addHearings(t testing.TB, db SongDB, hearings []songHearing) {
+	for _, h := range hearings {
+		if err := db.AddHearingAndSongIfNeededAt(h.Name, h.Date); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+}
+
+func TestRemoveLastHearingBackfilled(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	berlin := time.FixedZone("CEST", 2*60*60)
+	hearings := []songHearing{
+		{"a", now.Add(-time.Hour)},
+		{"b", now.Add(-30 * time.Minute).In(berlin)},
+		{"c", now.Add(-2 * time.Hour)}, // Backfilled after the others.
+	}
+	addHearings(t, db, hearings)
+
+	for _, want := range []string{"c", "b", "a"} {
+		got, err := db.RemoveLastHearing()
+		if err != nil {
+			t.Fatalf("Could not remove last hearing: %v", err)
+		}
+		if got != want {
+			t.Errorf("Removed hearing of %q, want %q", got, want)
+		}
+	}
+}
+
+func TestRemoveLastHearingOf(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	hearings := []songHearing{
+		{"Hello", now.Add(-3 * time.Hour)},
+		{"Hello", now.Add(-2 * time.Hour)},
+		{"Hello", now.Add(-time.Hour)},
+	}
+	addHearings(t, db, hearings)
+	if err := db.AddAlias("Hello", "Hello (Live)"); err != nil {
+		t.Fatalf("Could not add alias: %v", err)
+	}
+
+	for _, name := range []string{"hello", "HELLO (live)"} {
+		if err := db.RemoveLastHearingOf(name); err != nil {
+			t.Fatalf("Could not remove last hearing of %q: %v", name, err)
+		}
+	}
+	songs, err := db.RankFavourites(QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not rank songs: %v", err)
+	}
+	if len(songs) != 1 || songs[0].HearingCount != 1 ||
+		!songs[0].LastHeard.Equal(now.Add(-3*time.Hour).Truncate(time.Second)) {
+		t.Errorf("Got %+v, want Hello with only its first hearing", songs)
+	}
+}
+
+func TestLastAddedSong(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if _, err := db.LastAddedSong(); err == nil {
+		t.Errorf("Getting the last added song of an empty database did not fail")
+	}
+	for _, song := range []string{"b", "a"} {
+		if err := db.AddSong(song); err != nil {
+			t.Fatalf("Could not add song: %v", err)
+		}
+	}
+	if err := db.AddHearingAt("b", time.Now()); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	for _, want := range []string{"a", "b"} {
+		song, err := db.LastAddedSong()
+		if err != nil {
+			t.Fatalf("Could not get the last added song: %v", err)
+		}
+		if song != want {
+			t.Errorf("Got last added song %q, want %q", song, want)
+		}
+		if err = db.RemoveSong(song, Cascade); err != nil {
+			t.Fatalf("Could not remove song: %v", err)
+		}
+	}
+}
+
+func TestMixedTimezones(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// As strings, the hearing of "a" would be the latest.
+	utc := time.Now().UTC().Truncate(time.Second)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	if err := db.AddHearingAndSongIfNeededAt("a", utc.Add(-2*time.Hour).In(tokyo)); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	if err := db.AddHearingAndSongIfNeededAt("b", utc.Add(-time.Hour)); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	if err := db.AddHearingAndSongIfNeededAt("b", utc.Add(-3*time.Hour)); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+
+	songs, err := db.ListSongsInOrderOfLastHearing()
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"b", "a"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got songs %q in order of last hearing, want %q", songs, want)
+	}
+	songs, err = db.ListFavouriteSongsOmitting(90 * time.Minute)
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got favourite songs %q, want %q", songs, want)
+	}
+	songs, err = db.ListFrecentSongsOmitting(90 * time.Minute)
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got frecent songs %q, want %q", songs, want)
+	}
+}
+
+func TestRankFrecentSongs(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Second)
+	hearings := []songHearing{
+		{"c", now.Add(-time.Hour)},
+		{"b", now.Add(-time.Hour)},
+		{"a", now.Add(-time.Hour)},
+		{"a", now.Add(-2 * time.Hour)},
+	}
+	addHearings(t, db, hearings)
+	songs, err := db.RankFrecentSongs(QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not rank songs: %v", err)
+	}
+	// Songs with equal scores are ordered by name.
+	var names []string
+	for _, s := range songs {
+		names = append(names, s.Name)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Got songs %q, want %q", names, want)
+	}
+	if songs[0].HearingCount != 2 || !songs[0].LastHeard.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Got %+v, want 2 hearings, last at %v", songs[0], now.Add(-time.Hour))
+	}
+	if songs[0].Score <= songs[1].Score || songs[1].Score != songs[2].Score {
+		t.Errorf("Got unexpected scores %v, %v and %v",
+			songs[0].Score, songs[1].Score, songs[2].Score)
+	}
+}
+
+func TestRankSuggestions(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Second)
+	hearings := []songHearing{
+		{"seed", now.Add(-30 * 24 * time.Hour)},
+		{"far", now.Add(-30*24*time.Hour + 3*time.Hour)},
+		{"near", now.Add(-30*24*time.Hour - 10*time.Minute)},
+		{"seed", now.Add(-time.Hour)},
+		{"near", now.Add(-time.Hour + 5*time.Minute)},
+		{"unrelated", now.Add(-10 * 24 * time.Hour)},
+		{"near", now.Add(-10 * 24 * time.Hour)},
+	}
+	addHearings(t, db, hearings)
+	songs, err := db.RankSuggestions("seed", QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not rank suggestions: %v", err)
+	}
+	var names []string
+	for _, s := range songs {
+		names = append(names, s.Name)
+	}
+	if want := []string{"near", "far"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Got suggestions %q, want %q", names, want)
+	}
+	want := math.Pow(2, -10.0/60) + math.Pow(2, -5.0/60)
+	if math.Abs(songs[0].Score-want) > 1e-9 {
+		t.Errorf("Got score %v for near, want %v", songs[0].Score, want)
+	}
+	// Hearings outside of the window still count towards the statistics.
+	if songs[0].HearingCount != 3 || !songs[0].LastHeard.Equal(now.Add(-time.Hour+5*time.Minute)) {
+		t.Errorf("Got %+v, want 3 hearings, last at %v", songs[0], now.Add(-time.Hour+5*time.Minute))
+	}
+
+	if _, err = db.RankSuggestions("unknown", QueryOptions{}); err == nil {
+		t.Errorf("Ranking suggestions for an unknown song did not fail")
+	}
+}
@@ -0,0 +1,229 @@
+package songmem
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// versionWords are the words, that mark a song as another version of
+// the same song, like "Remastered 2011" or "(Live)".
+const versionWords = `(?:\d{4} )?(?:remaster(?:ed)?|live|mono|stereo|radio edit|` +
+	`single version|album version|bonus track|deluxe(?: edition)?)\b`
+
+var (
+	bracketFeatPattern    = regexp.MustCompile(`\s*[\(\[](?:feat|ft|featuring)\.?\s[^\)\]]*[\)\]]`)
+	bracketVersionPattern = regexp.MustCompile(`\s*[\(\[](?:[^\)\]]*\s)?` + versionWords + `[^\)\]]*[\)\]]`)
+)
+
+// foldedRunes are the replacements of letters with diacritics and
+// ligatures, that are folded to ASCII when normalizing song names.
+var foldedRunes = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ģ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ł': "l", 'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ř': "r", 'ß': "ss", 'ś': "s", 'ş': "s", 'š': "s", 'ţ': "t", 'ť': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z", '&': " and ",
+}
+
+// songNormalizer normalizes song names, whose artist and title are
+// separated by sep.
+type songNormalizer struct {
+	sep string // Folded like the names.
+
+	// featPattern matches featured artists, that are not in brackets,
+	// up until the separator or a bracket.
+	featPattern *regexp.Regexp
+
+	// dashVersionPattern matches version suffixes after a dash or the
+	// separator.
+	dashVersionPattern *regexp.Regexp
+}
+
+func newSongNormalizer(sep string) songNormalizer {
+	sep = foldName(sep)
+	featEnd, dash := `[\(\[]|$`, `\s-\s`
+	if sep != "" {
+		featEnd = regexp.QuoteMeta(sep) + `|` + featEnd
+		dash = `(?:` + dash + `|` + regexp.QuoteMeta(sep) + `)`
+	}
+	return songNormalizer{
+		sep:                sep,
+		featPattern:        regexp.MustCompile(`\s(?:feat|ft|featuring)\.?\s.*?(` + featEnd + `)`),
+		dashVersionPattern: regexp.MustCompile(dash + versionWords + `.*$`),
+	}
+}
+
+// normalize reduces name to what makes up the song, so that different
+// spellings and versions of a song have the same artist and title:
+// Case, diacritics, punctuation, featured artists and version suffixes
+// like "- Remastered 2011" or "(Live)" are removed. The artist is what
+// precedes the separator; it is empty, if name does not contain the
+// separator. Version suffixes after a dash are only recognized in the
+// title.
+func (n songNormalizer) normalize(name string) (artist, title string) {
+	title = bracketFeatPattern.ReplaceAllString(foldName(name), "")
+	title = n.featPattern.ReplaceAllString(title, "$1")
+	title = bracketVersionPattern.ReplaceAllString(title, "")
+	if i := strings.Index(title, n.sep); n.sep != "" && i >= 0 {
+		artist, title = title[:i], title[i+len(n.sep):]
+	}
+	title = n.dashVersionPattern.ReplaceAllString(title, "")
+	return strings.Join(searchWords(artist), " "), strings.Join(searchWords(title), " ")
+}
+
+// foldName lower cases s and replaces letters with diacritics and
+// ligatures; see foldedRunes.
+func foldName(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if f, ok := foldedRunes[r]; ok {
+			b.WriteString(f)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// songKey is the normalized artist and title of a song.
+type songKey struct {
+	artist, title string
+}
+
+// FindDuplicates finds songs, that are probably the same song under
+// different names. After their names were normalized, their artists
+// are the same and their titles are the same or differ by a few typos;
+// see songNormalizer and similarKeys for details.
+//
+// Each cluster of duplicates is ordered by the number of hearings, most
+// heard first, so that the first song is the one to keep, when merging
+// them. Clusters are ordered by the name of their first song.
+func (db SongDB) FindDuplicates() (clusters [][]Count, err error) {
+	rows, err := db.Query(`SELECT name, COUNT(hearing.id) FROM song
+	                       LEFT JOIN hearing ON song.id = hearing.songID
+	                       GROUP BY song.id`)
+	if err != nil {
+		return
+	}
+	var songs []Count
+	for rows.Next() {
+		var c Count
+		if err = rows.Scan(&c.Name, &c.Hearings); err != nil {
+			rows.Close()
+			return
+		}
+		songs = append(songs, c)
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+
+	normalizer := newSongNormalizer(db.Separator)
+	keys := make([]songKey, len(songs))
+	for i, s := range songs {
+		keys[i].artist, keys[i].title = normalizer.normalize(s.Name)
+	}
+	root := duplicateRoots(keys)
+	hearings := make(map[int]map[string]int)
+	for i, s := range songs {
+		r := root(i)
+		if hearings[r] == nil {
+			hearings[r] = make(map[string]int)
+		}
+		hearings[r][s.Name] = s.Hearings
+	}
+	for _, h := range hearings {
+		if len(h) > 1 {
+			clusters = append(clusters, topCounts(h, len(h)))
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0].Name < clusters[j][0].Name })
+	return
+}
+
+// duplicateRoots groups the indices of keys, that are equal or whose
+// titles differ by a few typos. The returned function returns the same
+// index for all indices of a group.
+//
+// To not compare every pair of keys, only keys of the same artist, whose
+// titles share their first or last six runes, are compared by edit
+// distance.
+func duplicateRoots(keys []songKey) func(i int) int {
+	parent := make([]int, len(keys))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+
+	blocks := make(map[songKey][]int)
+	for i, key := range keys {
+		if key.title == "" {
+			continue
+		}
+		runes := []rune(key.title)
+		head, tail := runes, runes
+		if len(runes) > 6 {
+			head, tail = runes[:6], runes[len(runes)-6:]
+		}
+		headKey := songKey{key.artist, "^" + string(head)}
+		tailKey := songKey{key.artist, "$" + string(tail)}
+		blocks[headKey] = append(blocks[headKey], i)
+		blocks[tailKey] = append(blocks[tailKey], i)
+	}
+	for _, block := range blocks {
+		for x, i := range block {
+			for _, j := range block[x+1:] {
+				if root(i) != root(j) && similarKeys(keys[i], keys[j]) {
+					parent[root(i)] = root(j)
+				}
+			}
+		}
+	}
+	return root
+}
+
+// similarKeys tells whether the keys a and b are of the same song. Their
+// artists must be equal. Their titles may differ by one typo per eight
+// runes of the shorter title, but not in their numbers, so that "Part 1"
+// and "Part 2" stay apart; short titles like "Stay" and "Say" must be
+// equal.
+func similarKeys(a, b songKey) bool {
+	if a.artist != b.artist {
+		return false
+	} else if a.title == b.title {
+		return true
+	}
+	if digits(a.title) != digits(b.title) {
+		return false
+	}
+	la, lb := len([]rune(a.title)), len([]rune(b.title))
+	maxTypos := la / 8
+	if lb < la {
+		maxTypos = lb / 8
+	}
+	if la-lb > maxTypos || lb-la > maxTypos {
+		return false
+	}
+	return editDistance(a.title, b.title) <= maxTypos
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,91 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSongNormalizer(t *testing.T) {
+	tests := []struct{ name, artist, title string }{
+		{"The Beatles - Let It Be - Remastered 2009", "the beatles", "let it be"},
+		{"The Beatles - Let It Be (2009 Remaster)", "the beatles", "let it be"},
+		{"Queen - Bohemian Rhapsody [Live at Wembley]", "queen", "bohemian rhapsody"},
+		{"Oasis - Live Forever", "oasis", "live forever"},
+		{"Oasis - Live Forever - Live", "oasis", "live forever"},
+		{"Daft Punk feat. Pharrell Williams - Get Lucky", "daft punk", "get lucky"},
+		{"Daft Punk - Get Lucky (feat. Pharrell Williams)", "daft punk", "get lucky"},
+		{"Daft Punk - Get Lucky ft. Pharrell Williams", "daft punk", "get lucky"},
+		{"Beyoncé - Déjà Vu", "beyonce", "deja vu"},
+		{"Simon & Garfunkel - Mrs. Robinson", "simon and garfunkel", "mrs robinson"},
+		{"Symphony No. 5 (Live)", "", "symphony no 5"},
+	}
+	normalizer := newSongNormalizer(DefaultSeparator)
+	for _, test := range tests {
+		artist, title := normalizer.normalize(test.name)
+		if artist != test.artist || title != test.title {
+			t.Errorf("Normalized %q to %q and %q, want %q and %q",
+				test.name, artist, title, test.artist, test.title)
+		}
+	}
+
+	// Custom separators are folded like the names.
+	customTests := []struct{ sep, name, artist, title string }{
+		{" – ", "Daft Punk feat. Pharrell Williams – Get Lucky – Live", "daft punk", "get lucky"},
+		{" – ", "Oasis – Live Forever - Remastered 2009", "oasis", "live forever"},
+		{" BY ", "Daft Punk ft. Pharrell BY Get Lucky", "daft punk", "get lucky"},
+	}
+	for _, test := range customTests {
+		artist, title := newSongNormalizer(test.sep).normalize(test.name)
+		if artist != test.artist || title != test.title {
+			t.Errorf("Normalized %q with separator %q to %q and %q, want %q and %q",
+				test.name, test.sep, artist, title, test.artist, test.title)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	hearings := []string{
+		"The Beatles - Let It Be",
+		"The Beatles - Let It Be",
+		"The Beatles - Let It Be - Remastered 2009",
+		"The Beatles - Let It Be - Remastered 2009",
+		"The Beatles - Let It Be - Remastered 2009",
+		"The Beatles - Let It Bee",
+		"Beatles - Yesterday",
+		"Symphony No. 5",
+		"Symphony No. 6",
+		"Beyoncé - Déjà Vu",
+		"Beyonce - Deja Vu (Live)",
+		"Rihanna - Stay",
+		"Rihanna - Say",
+		"Adele - Hello",
+		"Adele - Hell",
+		"Oasis - Wonderwall",
+		"Blur - Wonderwall",
+	}
+	for i, song := range hearings {
+		if err := db.AddHearingAndSongIfNeededAt(song, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	clusters, err := db.FindDuplicates()
+	if err != nil {
+		t.Fatalf("Could not find duplicates: %v", err)
+	}
+	want := [][]Count{
+		{{"Beyonce - Deja Vu (Live)", 1}, {"Beyoncé - Déjà Vu", 1}},
+		{
+			{"The Beatles - Let It Be - Remastered 2009", 3},
+			{"The Beatles - Let It Be", 2},
+			{"The Beatles - Let It Bee", 1},
+		},
+	}
+	if !reflect.DeepEqual(clusters, want) {
+		t.Errorf("Got duplicates %v, want %v", clusters, want)
+	}
+}
@@ -0,0 +1,158 @@
+package songmem
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportFormat identifies the format of a database export.
+type ExportFormat string
+
+const (
+	// JSONLines writes one JSON object per line. Songs are objects with
+	// the type "song", aliases objects with the type "alias" and
+	// hearings objects with the type "hearing".
+	JSONLines ExportFormat = "jsonl"
+
+	// CSV writes a CSV file with a header. The type column tells songs,
+	// aliases and hearings apart; columns that do not apply to a row are
+	// empty.
+	CSV ExportFormat = "csv"
+)
+
+type exportedSong struct {
+	Type    string `json:"type"`
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Artist  string `json:"artist,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Album   string `json:"album,omitempty"`
+	AddedAt string `json:"addedAt"`
+}
+
+type exportedAlias struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	SongID int64  `json:"songID"`
+}
+
+type exportedHearing struct {
+	Type    string `json:"type"`
+	ID      int64  `json:"id"`
+	SongID  int64  `json:"songID"`
+	HeardAt string `json:"heardAt"`
+}
+
+// Export writes all songs, followed by all aliases and all hearings, to
+// w. Timestamps
+// are written exactly as they are stored, so they keep their original
+// timezone offset.
+//
+// The JSONLines export can be imported again with the SongmemJSONL
+// import format.
+func (db SongDB) Export(w io.Writer, format ExportFormat) (err error) {
+	var writeSong func(exportedSong) error
+	var writeAlias func(exportedAlias) error
+	var writeHearing func(exportedHearing) error
+	var flush func() error
+	switch format {
+	case JSONLines:
+		enc := json.NewEncoder(w)
+		writeSong = func(s exportedSong) error { return enc.Encode(s) }
+		writeAlias = func(a exportedAlias) error { return enc.Encode(a) }
+		writeHearing = func(h exportedHearing) error { return enc.Encode(h) }
+		flush = func() error { return nil }
+	case CSV:
+		cw := csv.NewWriter(w)
+		err = cw.Write([]string{"type", "id", "name", "artist", "title", "album",
+			"addedAt", "songID", "heardAt"})
+		if err != nil {
+			return
+		}
+		writeSong = func(s exportedSong) error {
+			id := strconv.FormatInt(s.ID, 10)
+			return cw.Write([]string{s.Type, id, s.Name, s.Artist, s.Title,
+				s.Album, s.AddedAt, "", ""})
+		}
+		writeAlias = func(a exportedAlias) error {
+			id := strconv.FormatInt(a.ID, 10)
+			songID := strconv.FormatInt(a.SongID, 10)
+			return cw.Write([]string{a.Type, id, a.Name, "", "", "", "", songID, ""})
+		}
+		writeHearing = func(h exportedHearing) error {
+			id := strconv.FormatInt(h.ID, 10)
+			songID := strconv.FormatInt(h.SongID, 10)
+			return cw.Write([]string{h.Type, id, "", "", "", "", "", songID, h.HeardAt})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+
+	rows, err := db.Query(`SELECT id, name, artist, title, album, addedAt
+	                       FROM song ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := exportedSong{Type: "song"}
+		var artist, title, album sql.NullString
+		err = rows.Scan(&s.ID, &s.Name, &artist, &title, &album, &s.AddedAt)
+		if err != nil {
+			return
+		}
+		s.Artist, s.Title, s.Album = artist.String, title.String, album.String
+		if err = writeSong(s); err != nil {
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	rows, err = db.Query(`SELECT id, name, songID FROM alias ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := exportedAlias{Type: "alias"}
+		if err = rows.Scan(&a.ID, &a.Name, &a.SongID); err != nil {
+			return
+		}
+		if err = writeAlias(a); err != nil {
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	rows, err = db.Query(`SELECT id, songID, heardAt FROM hearing ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		h := exportedHearing{Type: "hearing"}
+		if err = rows.Scan(&h.ID, &h.SongID, &h.HeardAt); err != nil {
+			return
+		}
+		if err = writeHearing(h); err != nil {
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	return flush()
+}
@@ -0,0 +1,79 @@
+package songmem
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	base := time.Date(2020, 5, 17, 21, 30, 0, 0, tokyo)
+	for i, song := range []string{"Foo - Bar", "Foo - Baz", "Foo - Bar"} {
+		at := base.Add(time.Duration(i) * 5 * time.Minute)
+		if err := db.AddHearingAndSongIfNeededAt(song, at); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	if err := db.AddSongAt("Never - Heard", base.UTC()); err != nil {
+		t.Fatalf("Could not add song: %v", err)
+	}
+	if _, err := db.RemoveLastAddedSong(); err != nil {
+		t.Fatalf("Could not remove song: %v", err)
+	}
+	if err := db.AddSongAt("Qux - Quux", base.UTC()); err != nil {
+		t.Fatalf("Could not add song: %v", err)
+	}
+	if err := db.AddAlias("Foo - Bar", "Foo - Bar (Live)"); err != nil {
+		t.Fatalf("Could not add alias: %v", err)
+	}
+	if err := db.MergeSongs([]string{"Foo - Baz"}, "Foo - Bar"); err != nil {
+		t.Fatalf("Could not merge songs: %v", err)
+	}
+
+	var export bytes.Buffer
+	if err := db.Export(&export, JSONLines); err != nil {
+		t.Fatalf("Could not export: %v", err)
+	}
+
+	restored, cleanupRestored := newTestDB(t)
+	defer cleanupRestored()
+	sum, err := restored.Import(bytes.NewReader(export.Bytes()), SongmemJSONL)
+	if err != nil {
+		t.Fatalf("Could not import: %v", err)
+	}
+	if sum != (ImportSummary{Imported: 3}) {
+		t.Errorf("Import yielded %+v, want 3 imported hearings", sum)
+	}
+	var reexport bytes.Buffer
+	if err := restored.Export(&reexport, JSONLines); err != nil {
+		t.Fatalf("Could not export restored database: %v", err)
+	}
+	if export.String() != reexport.String() {
+		t.Errorf("Round trip is lossy:\n%s\nbecame\n%s", export.String(), reexport.String())
+	}
+	if !strings.Contains(export.String(), `"type":"alias","id":2,"name":"Foo - Baz"`) {
+		t.Errorf("Export lacks the alias of the merged song:\n%s", export.String())
+	}
+
+	// Importing again adds nothing.
+	sum, err = restored.Import(bytes.NewReader(export.Bytes()), SongmemJSONL)
+	if err != nil {
+		t.Fatalf("Could not import again: %v", err)
+	}
+	if sum != (ImportSummary{Duplicates: 3}) {
+		t.Errorf("Importing again yielded %+v, want 3 duplicates", sum)
+	}
+
+	var csv bytes.Buffer
+	if err := db.Export(&csv, CSV); err != nil {
+		t.Fatalf("Could not export CSV: %v", err)
+	}
+	if lines := strings.Count(csv.String(), "\n"); lines != 1+2+2+3 {
+		t.Errorf("CSV export has %d lines, want %d", lines, 1+2+2+3)
+	}
+}
@@ -6,15 +6,16 @@ import (
 )
 
 // See https://wiki.mozilla.org/User:Jesse/NewFrecency
-func songHearingsToFrecentSongs(shs []songHearing) []string {
+func songHearingsToFrecentSongs(shs []songHearing, opts QueryOptions) []ScoredSong {
 	now := time.Now()
-	const lambda float64 = 0.00096270442 // (ln 2) / (30 days * 24h)
+	lambda := math.Ln2 / opts.frecencyHalfLife().Hours()
 
 	songToFrecency := make(map[string]float64)
 	for _, sh := range shs {
-		hearingAge := now.Sub(sh.Date).Hours()
+		// Hearings from the future are treated as if they just happened.
+		hearingAge := math.Max(0, now.Sub(sh.Date).Hours())
 		songToFrecency[sh.Name] += math.Exp(-lambda * hearingAge)
 	}
 
-	return songRatingsToSongs(songToFrecency)
+	return rankSongs(songToFrecency, shs, opts.Offset, opts.Limit)
 }
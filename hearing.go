@@ -0,0 +1,112 @@
+package songmem
+
+import (
+	"errors"
+	"time"
+)
+
+// Hearing is a registered hearing of a song. HeardAt has the timezone,
+// in which the hearing was registered.
+type Hearing struct {
+	ID      int64
+	Song    string
+	HeardAt time.Time
+}
+
+// HearingFilter selects hearings. Zero fields do not restrict, which
+// hearings are selected.
+type HearingFilter struct {
+	// Song selects only the hearings of the song with this name.
+	Song string
+
+	// Since and Until select only hearings between them, inclusively.
+	Since time.Time
+	Until time.Time
+
+	// Offset skips the first hearings, in order of time. Limit is the
+	// maximum number of hearings; 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// query returns the condition, that selects the hearings, and its
+// arguments. Returns ErrSongNotFound, if filter.Song does not exist.
+func (filter HearingFilter) query(e execQueryer) (where string, args []interface{}, err error) {
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && filter.Since.After(filter.Until) {
+		return "", nil, errors.New("since is after until")
+	}
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return "", nil, errors.New("the offset and limit must not be negative")
+	}
+	since, until := unixBounds(filter.Since, filter.Until)
+	where = `heardAtUnix BETWEEN ? AND ?`
+	args = []interface{}{since, until}
+	if filter.Song != "" {
+		id, err := songID(e, filter.Song)
+		if err != nil {
+			return "", nil, err
+		}
+		where += ` AND songID = ?`
+		args = append(args, id)
+	}
+	if filter.Offset > 0 || filter.Limit > 0 {
+		limit, offset := QueryOptions{Offset: filter.Offset, Limit: filter.Limit}.sqlLimit()
+		where = `id IN (SELECT id FROM hearing WHERE ` + where + `
+		                ORDER BY heardAtUnix, id
+		                LIMIT ? OFFSET ?)`
+		args = append(args, limit, offset)
+	}
+	return
+}
+
+// ListHearings lists the hearings, that are selected by filter, in
+// order of time.
+func (db SongDB) ListHearings(filter HearingFilter) (hearings []Hearing, err error) {
+	where, args, err := filter.query(db)
+	if err != nil {
+		return
+	}
+	rows, err := db.Query(`SELECT hearing.id, name, heardAt FROM (
+	                           SELECT hearing.id, songID, heardAt, heardAtUnix
+	                           FROM hearing WHERE `+where+`
+	                       ) AS hearing
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       ORDER BY heardAtUnix, hearing.id`, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h Hearing
+		var heardAt string
+		if err = rows.Scan(&h.ID, &h.Song, &heardAt); err != nil {
+			return
+		}
+		if h.HeardAt, err = time.Parse(time.RFC3339, heardAt); err != nil {
+			return
+		}
+		hearings = append(hearings, h)
+	}
+	return hearings, rows.Err()
+}
+
+// RemoveHearings removes the hearings, that are selected by filter, and
+// returns how many were removed. Use ListHearings with the same filter,
+// to see which hearings would be removed.
+//
+// To prevent removing all hearings by accident, the filter must not be
+// empty.
+func (db SongDB) RemoveHearings(filter HearingFilter) (removed int64, err error) {
+	if filter == (HearingFilter{}) {
+		return 0, errors.New("the filter selects all hearings")
+	}
+	where, args, err := filter.query(db)
+	if err != nil {
+		return
+	}
+	r, err := db.Exec(`DELETE FROM hearing WHERE `+where, args...)
+	if err != nil {
+		return
+	}
+	return r.RowsAffected()
+}
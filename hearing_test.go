@@ -0,0 +1,89 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRemoveHearings(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Second)
+	hearings := []songHearing{
+		{"a", now.Add(-5 * time.Hour)},
+		{"b", now.Add(-4 * time.Hour)},
+		{"a", now.Add(-3 * time.Hour)},
+		{"b", now.Add(-2 * time.Hour)},
+		{"a", now.Add(-time.Hour)},
+	}
+	addHearings(t, db, hearings)
+	if _, err := db.RemoveHearings(HearingFilter{}); err == nil {
+		t.Errorf("Removing all hearings did not fail")
+	}
+	if _, err := db.RemoveHearings(HearingFilter{Song: "c"}); err != ErrSongNotFound {
+		t.Errorf("Got %v when removing the hearings of an unknown song", err)
+	}
+
+	listed, err := db.ListHearings(HearingFilter{Song: "a", Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Could not list hearings: %v", err)
+	}
+	if len(listed) != 1 || !listed[0].HeardAt.Equal(now.Add(-3*time.Hour)) {
+		t.Errorf("Got hearings %+v, want only the second of a", listed)
+	}
+
+	filter := HearingFilter{Song: "a", Since: now.Add(-4 * time.Hour), Until: now.Add(-time.Hour)}
+	listed, err = db.ListHearings(filter)
+	if err != nil {
+		t.Fatalf("Could not list hearings: %v", err)
+	}
+	if len(listed) != 2 || !listed[0].HeardAt.Equal(now.Add(-3*time.Hour)) || listed[1].Song != "a" {
+		t.Errorf("Got hearings %+v, want the last two of a", listed)
+	}
+	removed, err := db.RemoveHearings(filter)
+	if err != nil {
+		t.Fatalf("Could not remove hearings: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Removed %d hearings, want 2", removed)
+	}
+	if _, err = db.RemoveHearings(HearingFilter{Until: now.Add(-4 * time.Hour)}); err != nil {
+		t.Fatalf("Could not remove hearings: %v", err)
+	}
+	listed, err = db.ListHearings(HearingFilter{})
+	if err != nil {
+		t.Fatalf("Could not list hearings: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Song != "b" || !listed[0].HeardAt.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("Got hearings %+v after removing, want the last of b", listed)
+	}
+}
+
+func TestRemoveSongCascade(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	for _, song := range []string{"a", "a", "b"} {
+		if err := db.AddHearingAndSongIfNeeded(song); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	if err := db.RemoveSong("a"); err == nil {
+		t.Errorf("Removing a song with hearings did not fail")
+	}
+	if err := db.RemoveSong("a", Cascade); err != nil {
+		t.Fatalf("Could not remove song: %v", err)
+	}
+	if err := db.RemoveSong("a", Cascade); err != ErrSongNotFound {
+		t.Errorf("Got %v when removing a removed song", err)
+	}
+	songs, err := db.ListFavouriteSongs()
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got songs %q, want %q", songs, want)
+	}
+}
@@ -0,0 +1,501 @@
+package songmem
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportFormat identifies the format of a listening history export.
+type ImportFormat string
+
+const (
+	// LastFMCSV is a CSV export of Last.fm scrobbles. Exports with a
+	// header row are supported as well as those without, which contain
+	// artist, album, title and date columns.
+	LastFMCSV ImportFormat = "lastfm-csv"
+
+	// ListenBrainzJSON is a ListenBrainz listens dump, either as one
+	// JSON array or as one listen per line.
+	ListenBrainzJSON ImportFormat = "listenbrainz-json"
+
+	// ScrobblerLog is a .scrobbler.log file, as written by portable
+	// players like Rockbox.
+	ScrobblerLog ImportFormat = "scrobbler-log"
+
+	// SongmemJSONL is the JSONLines export of songmem itself. Importing
+	// it into an empty database restores the exported database exactly,
+	// including IDs and timezone offsets.
+	SongmemJSONL ImportFormat = "songmem-jsonl"
+)
+
+// ImportSummary describes the outcome of an import.
+type ImportSummary struct {
+	// Imported is the number of hearings that were added.
+	Imported int
+
+	// Skipped is the number of rows that could not be imported,
+	// because they were malformed, lacked a title, had an invalid name
+	// or were marked as skipped by the player.
+	Skipped int
+
+	// Duplicates is the number of hearings that were already in the
+	// database.
+	Duplicates int
+}
+
+type importedHearing struct {
+	Artist string
+	Title  string
+	Album  string
+	Date   time.Time
+}
+
+// song returns the heard song, named "<artist><sep><title>". If the
+// artist is unknown, the song is named only by its title.
+func (ih importedHearing) song(sep string) Song {
+	s := Song{
+		Artist: strings.TrimSpace(ih.Artist),
+		Title:  strings.TrimSpace(ih.Title),
+		Album:  strings.TrimSpace(ih.Album),
+	}
+	s.Name = s.Title
+	if s.Artist != "" {
+		s.Name = s.Artist + sep + s.Title
+	}
+	return s
+}
+
+// validName tells whether name can be the name of a song. It must not
+// be empty, be longer than MaxNameLength or contain a newline.
+func validName(name string) bool {
+	return name != "" && len(name) <= MaxNameLength && !strings.Contains(name, "\n")
+}
+
+// Import reads a listening history in the given format from r and
+// adds all contained hearings with their original timestamps. Songs
+// are added to the database if necessary. They are named "<artist> -
+// <title>", using the database's separator. Hearings, that are
+// already in the database, are not added again.
+//
+// Either all hearings are imported or, if an error occurs, none.
+func (db SongDB) Import(r io.Reader, format ImportFormat) (sum ImportSummary, err error) {
+	var ihs []importedHearing
+	switch format {
+	case LastFMCSV:
+		ihs, sum.Skipped, err = parseLastFMCSV(r)
+	case ListenBrainzJSON:
+		ihs, sum.Skipped, err = parseListenBrainzJSON(r)
+	case ScrobblerLog:
+		ihs, sum.Skipped, err = parseScrobblerLog(r)
+	case SongmemJSONL:
+		return db.importSongmemJSONL(r)
+	default:
+		err = fmt.Errorf("unknown import format '%s'", format)
+	}
+	if err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for _, ih := range ihs {
+		song := ih.song(db.Separator)
+		if song.Title == "" || !validName(song.Name) {
+			sum.Skipped++
+			continue
+		}
+		var duplicate bool
+		if duplicate, err = hearingExists(tx, song.Name, ih.Date); err != nil {
+			return
+		} else if duplicate {
+			sum.Duplicates++
+			continue
+		}
+		if err = addHearingAndSongIfNeededAt(tx, song, ih.Date); err != nil {
+			return
+		}
+		sum.Imported++
+	}
+	err = tx.Commit()
+	return
+}
+
+// hearingExists checks whether the given song or the song it is an
+// alias of was heard at the same instant as t.
+func hearingExists(e execQueryer, song string, t time.Time) (exists bool, err error) {
+	if song, err = resolveAlias(e, song); err != nil {
+		return
+	}
+	err = e.QueryRow(`SELECT EXISTS(
+	                      SELECT 1 FROM hearing
+	                      INNER JOIN song ON song.id = hearing.songID
+	                      WHERE name = ? COLLATE NOCASE AND heardAtUnix = ?
+	                  )`, song, t.Unix()).Scan(&exists)
+	return
+}
+
+func parseLastFMCSV(r io.Reader) (ihs []importedHearing, skipped int, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	artistCol, albumCol, titleCol, dateCol := 0, 1, 2, 3
+	first := true
+	for {
+		var record []string
+		record, err = cr.Read()
+		if err == io.EOF {
+			return ihs, skipped, nil
+		} else if _, ok := err.(*csv.ParseError); ok {
+			skipped++
+			continue
+		} else if err != nil {
+			return
+		}
+		if first {
+			first = false
+			if a, al, t, d, ok := lastFMHeader(record); ok {
+				artistCol, albumCol, titleCol, dateCol = a, al, t, d
+				continue
+			}
+		}
+		if len(record) <= artistCol || len(record) <= titleCol || len(record) <= dateCol {
+			skipped++
+			continue
+		}
+		date, dateErr := parseLastFMDate(record[dateCol])
+		if dateErr != nil {
+			skipped++
+			continue
+		}
+		ih := importedHearing{
+			Artist: record[artistCol],
+			Title:  record[titleCol],
+			Date:   date,
+		}
+		if albumCol >= 0 && albumCol < len(record) {
+			ih.Album = record[albumCol]
+		}
+		ihs = append(ihs, ih)
+	}
+}
+
+// lastFMHeader returns the indices of the artist, album, title and
+// date columns, if record is a header row. The album column is
+// optional; its index is -1, if it is missing.
+func lastFMHeader(record []string) (artist, album, title, date int, ok bool) {
+	artist, album, title, date = -1, -1, -1, -1
+	for i, field := range record {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "artist", "artist_name":
+			artist = i
+		case "album", "album_name":
+			album = i
+		case "track", "title", "track_name", "name":
+			title = i
+		case "uts", "timestamp", "date", "utc_time":
+			// Prefer the unix timestamp, if there are multiple date columns.
+			if date == -1 || strings.EqualFold(field, "uts") {
+				date = i
+			}
+		}
+	}
+	ok = artist != -1 && title != -1 && date != -1
+	return
+}
+
+func parseLastFMDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if uts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(uts, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	// Last.fm exports dates in UTC without specifying a timezone.
+	layouts := [...]string{
+		"02 Jan 2006 15:04",
+		"02 Jan 2006, 15:04",
+		"2 Jan 2006 15:04",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Local(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format '%s'", s)
+}
+
+type listenBrainzListen struct {
+	ListenedAt    int64 `json:"listened_at"`
+	TrackMetadata struct {
+		ArtistName  string `json:"artist_name"`
+		TrackName   string `json:"track_name"`
+		ReleaseName string `json:"release_name"`
+	} `json:"track_metadata"`
+}
+
+func parseListenBrainzJSON(r io.Reader) (ihs []importedHearing, skipped int, err error) {
+	br := bufio.NewReader(r)
+	isArray, err := startsWith(br, '[')
+	if err != nil {
+		return
+	}
+	dec := json.NewDecoder(br)
+	if isArray {
+		if _, err = dec.Token(); err != nil {
+			return
+		}
+	}
+	for !isArray || dec.More() {
+		var listen listenBrainzListen
+		if err = dec.Decode(&listen); err == io.EOF {
+			return ihs, skipped, nil
+		} else if err != nil {
+			return
+		}
+		if listen.ListenedAt <= 0 {
+			skipped++
+			continue
+		}
+		ihs = append(ihs, importedHearing{
+			Artist: listen.TrackMetadata.ArtistName,
+			Title:  listen.TrackMetadata.TrackName,
+			Album:  listen.TrackMetadata.ReleaseName,
+			Date:   time.Unix(listen.ListenedAt, 0),
+		})
+	}
+	return
+}
+
+// startsWith reports whether the first non-space byte of br is c,
+// without consuming it.
+func startsWith(br *bufio.Reader, c byte) (bool, error) {
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b == c, br.UnreadByte()
+		}
+	}
+}
+
+func parseScrobblerLog(r io.Reader) (ihs []importedHearing, skipped int, err error) {
+	// Each line holds the tab separated fields of one hearing. Lines
+	// starting with # are headers; #TZ/UTC states that the timestamps
+	// are in UTC.
+	const (
+		artistCol = iota
+		albumCol
+		titleCol
+		trackNumCol
+		lengthCol
+		ratingCol
+		timestampCol
+	)
+	utc := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, "#TZ/") {
+				utc = strings.TrimPrefix(line, "#TZ/") == "UTC"
+			}
+			continue
+		} else if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) <= timestampCol || fields[ratingCol] == "S" {
+			skipped++
+			continue
+		}
+		ts, parseErr := strconv.ParseInt(fields[timestampCol], 10, 64)
+		if parseErr != nil {
+			skipped++
+			continue
+		}
+		date := time.Unix(ts, 0)
+		if !utc {
+			// The timestamp is the player's wall clock time, written as
+			// if it was UTC.
+			u := date.UTC()
+			date = time.Date(u.Year(), u.Month(), u.Day(), u.Hour(),
+				u.Minute(), u.Second(), 0, time.Local)
+		}
+		ihs = append(ihs, importedHearing{
+			Artist: fields[artistCol],
+			Title:  fields[titleCol],
+			Album:  fields[albumCol],
+			Date:   date,
+		})
+	}
+	err = scanner.Err()
+	return
+}
+
+func (db SongDB) importSongmemJSONL(r io.Reader) (sum ImportSummary, err error) {
+	var songs []exportedSong
+	var aliases []exportedAlias
+	var hearings []exportedHearing
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		var record struct {
+			Type string `json:"type"`
+		}
+		if err = json.Unmarshal(raw, &record); err != nil {
+			return
+		}
+		switch record.Type {
+		case "song":
+			var s exportedSong
+			if err = json.Unmarshal(raw, &s); err != nil {
+				return
+			}
+			songs = append(songs, s)
+		case "alias":
+			var a exportedAlias
+			if err = json.Unmarshal(raw, &a); err != nil {
+				return
+			}
+			aliases = append(aliases, a)
+		case "hearing":
+			var h exportedHearing
+			if err = json.Unmarshal(raw, &h); err != nil {
+				return
+			}
+			hearings = append(hearings, h)
+		default:
+			sum.Skipped++
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	songIDs := make(map[int64]int64) // Exported ID to ID in the database.
+	for _, s := range songs {
+		addedAt, parseErr := time.Parse(time.RFC3339, s.AddedAt)
+		if !validName(s.Name) || parseErr != nil {
+			sum.Skipped++
+			continue
+		}
+		if songIDs[s.ID], err = importSong(tx, s, addedAt); err != nil {
+			return
+		}
+	}
+	for _, a := range aliases {
+		songID, ok := songIDs[a.SongID]
+		if !ok || !validName(a.Name) {
+			sum.Skipped++
+			continue
+		}
+		if ok, err = importAlias(tx, a, songID); err != nil {
+			return
+		} else if !ok {
+			sum.Skipped++
+		}
+	}
+	for _, h := range hearings {
+		songID, ok := songIDs[h.SongID]
+		heardAt, parseErr := time.Parse(time.RFC3339, h.HeardAt)
+		if !ok || parseErr != nil {
+			sum.Skipped++
+			continue
+		}
+		var duplicate bool
+		err = tx.QueryRow(`SELECT EXISTS(
+		                       SELECT 1 FROM hearing
+		                       WHERE songID = ? AND heardAtUnix = ?
+		                   )`, songID, heardAt.Unix()).Scan(&duplicate)
+		if err != nil {
+			return
+		} else if duplicate {
+			sum.Duplicates++
+			continue
+		}
+		_, err = insertWithID(tx, h.ID, `INSERT INTO hearing(id, songID, heardAt, heardAtUnix)
+		                                 VALUES (?, ?, ?, ?)`, songID, h.HeardAt, heardAt.Unix())
+		if err != nil {
+			return
+		}
+		sum.Imported++
+	}
+	err = tx.Commit()
+	return
+}
+
+// importSong adds the exported song, unless a song or alias with the
+// same name already exists. Returns the ID of the song in the database.
+func importSong(e execQueryer, s exportedSong, addedAt time.Time) (id int64, err error) {
+	err = e.QueryRow(`SELECT id FROM song WHERE name = ?1 COLLATE NOCASE
+	                  UNION ALL
+	                  SELECT songID FROM alias WHERE name = ?1 COLLATE NOCASE
+	                  LIMIT 1`, s.Name).Scan(&id)
+	if err != sql.ErrNoRows {
+		return
+	}
+	return insertWithID(e, s.ID, `INSERT INTO song(id, name, artist, title, album,
+	                                               addedAt, addedAtUnix)
+	                              VALUES (?, ?, ?, ?, ?, ?, ?)`, s.Name, nullString(s.Artist),
+		nullString(s.Title), nullString(s.Album), s.AddedAt, addedAt.Unix())
+}
+
+// importAlias adds the exported alias of the song with the given ID,
+// unless it exists already. ok is false, if the alias' name is used by
+// another song or an alias of another song.
+func importAlias(e execQueryer, a exportedAlias, songID int64) (ok bool, err error) {
+	aliasOf, isAlias, err := aliasSongID(e, a.Name)
+	if err != nil || isAlias {
+		return aliasOf == songID, err
+	}
+	var isSong bool
+	err = e.QueryRow(`SELECT EXISTS(SELECT 1 FROM song WHERE name = ? COLLATE NOCASE)`,
+		a.Name).Scan(&isSong)
+	if err != nil || isSong {
+		return false, err
+	}
+	_, err = insertWithID(e, a.ID, `INSERT INTO alias(id, name, songID) VALUES (?, ?, ?)`,
+		a.Name, songID)
+	return err == nil, err
+}
+
+// insertWithID executes query, which must take the preferred ID as its
+// first argument, followed by args. If the preferred ID is already
+// taken, a new one is chosen. Returns the ID of the inserted row.
+func insertWithID(e execQueryer, id int64, query string, args ...interface{}) (int64, error) {
+	r, err := e.Exec(query, append([]interface{}{id}, args...)...)
+	sqliteErr, ok := err.(sqlite3.Error)
+	if ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		// Inserting NULL lets SQLite choose a new ID.
+		r, err = e.Exec(query, append([]interface{}{nil}, args...)...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
@@ -0,0 +1,92 @@
+package songmem
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		format ImportFormat
+		input  string
+		want   ImportSummary
+	}{
+		{
+			format: LastFMCSV,
+			input: "uts,utc_time,artist,artist_mbid,album,album_mbid,track,track_mbid\n" +
+				"1600000000,\"13 Sep 2020, 12:26\",Foo,,Bar,,Baz,\n" +
+				"1600000300,\"13 Sep 2020, 12:31\",Foo,,Bar,,Qux,\n" +
+				"1600000300,\"13 Sep 2020, 12:31\",Foo,,Bar,,Qux,\n" +
+				"not a timestamp,,Foo,,Bar,,Baz,\n",
+			want: ImportSummary{Imported: 2, Skipped: 1, Duplicates: 1},
+		},
+		{
+			format: LastFMCSV,
+			input: "Foo,Bar,Baz,13 Sep 2020 12:26\n" +
+				"Foo,Bar,,13 Sep 2020 12:31\n",
+			want: ImportSummary{Imported: 1, Skipped: 1},
+		},
+		{
+			format: ListenBrainzJSON,
+			input: `[{"listened_at": 1600000000, "track_metadata": {"artist_name": "Foo", "track_name": "Baz"}},
+			         {"listened_at": 1600000300, "track_metadata": {"artist_name": "Foo", "track_name": "Qux"}}]`,
+			want: ImportSummary{Imported: 2},
+		},
+		{
+			format: ListenBrainzJSON,
+			input: `{"listened_at": 1600000000, "track_metadata": {"artist_name": "Foo", "track_name": "Baz"}}
+			        {"listened_at": 0, "track_metadata": {"artist_name": "Foo", "track_name": "Qux"}}`,
+			want: ImportSummary{Imported: 1, Skipped: 1},
+		},
+		{
+			format: ScrobblerLog,
+			input: "#AUDIOSCROBBLER/1.1\n#TZ/UTC\n#CLIENT/Rockbox\n" +
+				"Foo\tBar\tBaz\t1\t200\tL\t1600000000\t\n" +
+				"Foo\tBar\tQux\t2\t180\tS\t1600000200\t\n",
+			want: ImportSummary{Imported: 1, Skipped: 1},
+		},
+		{
+			format: SongmemJSONL,
+			input: `{"type":"song","id":1,"name":"Foo - Bar","addedAt":"2020-09-13T12:26:00Z"}
+			        {"type":"song","id":2,"name":"","addedAt":"2020-09-13T12:26:00Z"}
+			        {"type":"song","id":3,"name":"` + strings.Repeat("x", 101) + `","addedAt":"2020-09-13T12:26:00Z"}
+			        {"type":"hearing","id":1,"songID":1,"heardAt":"2020-09-13T12:26:00Z"}
+			        {"type":"hearing","id":2,"songID":3,"heardAt":"2020-09-13T12:31:00Z"}`,
+			want: ImportSummary{Imported: 1, Skipped: 3},
+		},
+	}
+	for _, test := range tests {
+		db, cleanup := newTestDB(t)
+		sum, err := db.Import(strings.NewReader(test.input), test.format)
+		if err != nil {
+			t.Errorf("Could not import %s: %v", test.format, err)
+		} else if sum != test.want {
+			t.Errorf("Importing %s yielded %+v, want %+v", test.format, sum, test.want)
+		}
+		cleanup()
+	}
+}
+
+func TestImportIsIdempotent(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	input := "Foo,Bar,Baz,13 Sep 2020 12:26\n"
+	if _, err := db.Import(strings.NewReader(input), LastFMCSV); err != nil {
+		t.Fatalf("Could not import: %v", err)
+	}
+	sum, err := db.Import(strings.NewReader(input), LastFMCSV)
+	if err != nil {
+		t.Fatalf("Could not import again: %v", err)
+	}
+	if sum.Imported != 0 || sum.Duplicates != 1 {
+		t.Errorf("Second import yielded %+v, want only one duplicate", sum)
+	}
+	songs, err := db.ListSongsInOrderOfAddition()
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if len(songs) != 1 || songs[0] != "Foo - Baz" {
+		t.Errorf("Got songs %q, want only %q", songs, "Foo - Baz")
+	}
+}
@@ -0,0 +1,356 @@
+package songmem
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// AutoqueueOptions adjust how Autoqueue walks the transitions between
+// songs. The zero value walks first-order transitions with temperature
+// 0, which always picks the most common next song.
+type AutoqueueOptions struct {
+	// Omit excludes songs, that were heard within this timespan before
+	// now.
+	Omit time.Duration
+
+	// Temperature controls how adventurous the queue is. The
+	// probability of a song to be picked next is proportional to
+	// count^(1/Temperature), where count is the number of times the song
+	// followed the current song. At 1, songs are picked exactly as often
+	// as they followed the current song; higher temperatures make rare
+	// transitions more likely. At 0, the most common transition is always
+	// picked.
+	Temperature float64
+
+	// SecondOrder makes the next song depend on the last two songs of
+	// the queue, if there is any transition from them. Otherwise it
+	// falls back to the last song.
+	SecondOrder bool
+
+	// SessionGap replaces DefaultSessionGap, if it is not zero. Only
+	// consecutive hearings within a session are transitions.
+	SessionGap time.Duration
+
+	// Rand is the source of randomness. If it is nil, a source seeded
+	// with the current time is used.
+	Rand *rand.Rand
+}
+
+// Validate checks whether the options are sensible.
+func (opts AutoqueueOptions) Validate() error {
+	if opts.Omit < 0 {
+		return errors.New("the omit timespan is negative")
+	}
+	if !(opts.Temperature >= 0) || math.IsInf(opts.Temperature, 1) {
+		return fmt.Errorf("invalid temperature %g", opts.Temperature)
+	}
+	if opts.SessionGap < 0 {
+		return errors.New("the session gap is negative")
+	}
+	return nil
+}
+
+// Autoqueue generates a queue of up to length songs, that could be
+// heard after seed, by walking a Markov chain of the transitions
+// between consecutive hearings. The seed is not part of the queue and
+// no song is queued twice.
+//
+// If the current song has no transition to a song, that was not
+// queued yet, the transitions from the songs before it are used. The
+// queue is shorter than length, if no song is left to pick.
+func (db SongDB) Autoqueue(seed string, length int, opts AutoqueueOptions) (songs []string, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	if length < 1 {
+		return nil, errors.New("the length must be positive")
+	}
+	gap := opts.SessionGap
+	if gap == 0 {
+		gap = DefaultSessionGap
+	}
+	r := opts.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if err = db.updateTransitions(gap); err != nil {
+		return
+	}
+
+	// Like when registering hearings, the seed may be an alias and its
+	// case does not matter.
+	if seed, err = resolveAlias(db, seed); err != nil {
+		return
+	}
+	seedID, err := songID(db, seed)
+	if err != nil {
+		return
+	}
+	excluded, err := db.omittedSongIDs(opts.Omit)
+	if err != nil {
+		return
+	}
+	queue := []int64{seedID}
+	excluded[seedID] = true
+	for len(queue) <= length {
+		next, ok, err := db.pickNext(queue, excluded, opts, r)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		queue = append(queue, next)
+		excluded[next] = true
+	}
+
+	for _, id := range queue[1:] {
+		var name string
+		if err = db.QueryRow(`SELECT name FROM song WHERE id = ?`, id).Scan(&name); err != nil {
+			return
+		}
+		songs = append(songs, name)
+	}
+	return
+}
+
+// pickNext picks the song to follow queue. ok is false, if there is no
+// transition to a song, that is not excluded.
+func (db SongDB) pickNext(queue []int64, excluded map[int64]bool, opts AutoqueueOptions, r *rand.Rand) (next int64, ok bool, err error) {
+	for i := len(queue) - 1; i >= 0; i-- {
+		if opts.SecondOrder && i > 0 {
+			next, ok, err = db.pickTransition(queue[i-1], queue[i], excluded, opts.Temperature, r)
+			if err != nil || ok {
+				return
+			}
+		}
+		next, ok, err = db.pickTransition(0, queue[i], excluded, opts.Temperature, r)
+		if err != nil || ok {
+			return
+		}
+	}
+	return
+}
+
+// pickTransition picks a random transition from the songs prevID and
+// fromID. A prevID of 0 means, that only fromID is considered.
+func (db SongDB) pickTransition(prevID, fromID int64, excluded map[int64]bool, temperature float64, r *rand.Rand) (next int64, ok bool, err error) {
+	rows, err := db.Query(`SELECT toID, count FROM transition
+	                       WHERE prevID = ? AND fromID = ?
+	                       ORDER BY count DESC, toID`, prevID, fromID)
+	if err != nil {
+		return
+	}
+	type candidate struct {
+		id    int64
+		count float64
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err = rows.Scan(&c.id, &c.count); err != nil {
+			rows.Close()
+			return
+		}
+		if !excluded[c.id] {
+			candidates = append(candidates, c)
+		}
+	}
+	if err = rows.Close(); err != nil || len(candidates) == 0 {
+		return
+	}
+	if temperature == 0 {
+		return candidates[0].id, true, nil
+	}
+
+	// The weights are calculated relative to the most common transition,
+	// so that low temperatures do not overflow.
+	maxLog := math.Log(candidates[0].count)
+	weights := make([]float64, len(candidates))
+	var sum float64
+	for i, c := range candidates {
+		weights[i] = math.Exp((math.Log(c.count) - maxLog) / temperature)
+		sum += weights[i]
+	}
+	x := r.Float64() * sum
+	for i, w := range weights {
+		if x < w {
+			return candidates[i].id, true, nil
+		}
+		x -= w
+	}
+	return candidates[len(candidates)-1].id, true, nil
+}
+
+// omittedSongIDs returns the IDs of the songs, that were heard within
+// the omit timespan before now.
+func (db SongDB) omittedSongIDs(omit time.Duration) (ids map[int64]bool, err error) {
+	ids = make(map[int64]bool)
+	rows, err := db.Query(`SELECT DISTINCT songID FROM hearing WHERE heardAtUnix > ?`,
+		omitDeadline(omit))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// updateTransitions rebuilds the transition table, if hearings changed
+// since it was built or it was built with a different session gap.
+func (db SongDB) updateTransitions(gap time.Duration) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var generation, builtGeneration, builtGap int64
+	err = tx.QueryRow(`SELECT hearingGeneration.generation,
+	                          transitionInfo.generation, transitionInfo.gap
+	                   FROM hearingGeneration, transitionInfo`).Scan(
+		&generation, &builtGeneration, &builtGap)
+	if err != nil {
+		return
+	}
+	gapSeconds := int64(gap / time.Second)
+	if generation == builtGeneration && gapSeconds == builtGap {
+		return
+	}
+	if err = buildTransitions(tx, gapSeconds); err != nil {
+		return
+	}
+	_, err = tx.Exec(`UPDATE transitionInfo SET generation = ?, gap = ?`,
+		generation, gapSeconds)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// buildTransitions counts the first- and second-order transitions
+// between consecutive hearings, that are at most gapSeconds apart.
+func buildTransitions(tx *sql.Tx, gapSeconds int64) (err error) {
+	type transition struct{ prevID, fromID, toID int64 }
+	counts := make(map[transition]int)
+	rows, err := tx.Query(`SELECT songID, heardAtUnix FROM hearing
+	                       ORDER BY heardAtUnix, id`)
+	if err != nil {
+		return
+	}
+	var prevID, fromID, fromUnix int64
+	for rows.Next() {
+		var id, heardAtUnix int64
+		if err = rows.Scan(&id, &heardAtUnix); err != nil {
+			rows.Close()
+			return
+		}
+		if fromID == 0 || heardAtUnix-fromUnix > gapSeconds {
+			prevID = 0 // A new session starts.
+		} else {
+			counts[transition{0, fromID, id}]++
+			if prevID != 0 {
+				counts[transition{prevID, fromID, id}]++
+			}
+			prevID = fromID
+		}
+		fromID, fromUnix = id, heardAtUnix
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(`DELETE FROM transition`); err != nil {
+		return
+	}
+	stmt, err := tx.Prepare(`INSERT INTO transition(prevID, fromID, toID, count)
+	                         VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	for t, count := range counts {
+		if _, err = stmt.Exec(t.prevID, t.fromID, t.toID, count); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// addTransitionCache adds the table, that caches the transitions
+// between songs. The generation is increased by triggers, whenever
+// hearings change, so that the cache can be rebuilt when it is
+// outdated.
+func addTransitionCache(db SongDB, tx *sql.Tx) (err error) {
+	commands := [...]string{
+		`CREATE TABLE transition(
+		     prevID  INTEGER NOT NULL,
+		     fromID  INTEGER NOT NULL,
+		     toID    INTEGER NOT NULL,
+		     count   INTEGER NOT NULL,
+		     PRIMARY KEY(prevID, fromID, toID)
+		 )`,
+		`CREATE TABLE hearingGeneration(generation INTEGER NOT NULL)`,
+		`INSERT INTO hearingGeneration VALUES (1)`,
+		`CREATE TABLE transitionInfo(
+		     generation INTEGER NOT NULL,
+		     gap        INTEGER NOT NULL
+		 )`,
+		`INSERT INTO transitionInfo VALUES (0, 0)`,
+		`CREATE TRIGGER hearing_insert AFTER INSERT ON hearing BEGIN
+		     UPDATE hearingGeneration SET generation = generation + 1;
+		 END`,
+		`CREATE TRIGGER hearing_update AFTER UPDATE ON hearing BEGIN
+		     UPDATE hearingGeneration SET generation = generation + 1;
+		 END`,
+		`CREATE TRIGGER hearing_delete AFTER DELETE ON hearing BEGIN
+		     UPDATE hearingGeneration SET generation = generation + 1;
+		 END`}
+	for _, c := range commands {
+		if _, err = tx.Exec(c); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// guardGenerationTriggers replaces the triggers, that increase the
+// generations of hearings and songs, with ones, that only increase a
+// generation, if the cache built from it is up to date. This way, bulk
+// changes like imports and merges write the generation only once,
+// instead of once for every row.
+func guardGenerationTriggers(db SongDB, tx *sql.Tx) (err error) {
+	triggers := [...]struct{ name, event, generation, cacheInfo string }{
+		{"hearing_insert", "INSERT ON hearing", "hearingGeneration", "transitionInfo"},
+		{"hearing_update", "UPDATE ON hearing", "hearingGeneration", "transitionInfo"},
+		{"hearing_delete", "DELETE ON hearing", "hearingGeneration", "transitionInfo"},
+		{"song_insert", "INSERT ON song", "songGeneration", "searchIndexInfo"},
+		{"song_update", "UPDATE OF name ON song", "songGeneration", "searchIndexInfo"},
+		{"song_delete", "DELETE ON song", "songGeneration", "searchIndexInfo"},
+	}
+	for _, t := range triggers {
+		commands := [...]string{
+			`DROP TRIGGER ` + t.name,
+			`CREATE TRIGGER ` + t.name + ` AFTER ` + t.event + `
+			 WHEN (SELECT generation FROM ` + t.generation + `) =
+			      (SELECT generation FROM ` + t.cacheInfo + `)
+			 BEGIN
+			     UPDATE ` + t.generation + ` SET generation = generation + 1;
+			 END`}
+		for _, c := range commands {
+			if _, err = tx.Exec(c); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package songmem
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAutoqueue(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Two sessions: a b c d and a b e, followed by x much later.
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	hearings := []struct {
+		song    string
+		minutes int
+	}{
+		{"a", 0}, {"b", 4}, {"c", 8}, {"d", 12},
+		{"a", 120}, {"b", 124}, {"c", 128}, {"e", 132},
+		{"x", 600},
+	}
+	for _, h := range hearings {
+		at := start.Add(time.Duration(h.minutes) * time.Minute)
+		if err := db.AddHearingAndSongIfNeededAt(h.song, at); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+
+	songs, err := db.Autoqueue("a", 10, AutoqueueOptions{})
+	if err != nil {
+		t.Fatalf("Could not generate queue: %v", err)
+	}
+	// The transitions from c to d and e are equally common; the one to
+	// the song with the lower ID wins. Since nothing follows d, the queue
+	// continues with the transitions from c. x is never reached.
+	if want := []string{"b", "c", "d", "e"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got queue %q, want %q", songs, want)
+	}
+
+	// Like when registering hearings, the case of the seed is ignored.
+	songs, err = db.Autoqueue("A", 1, AutoqueueOptions{})
+	if err != nil {
+		t.Fatalf("Could not generate queue for differently cased seed: %v", err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got queue %q, want %q", songs, want)
+	}
+
+	// A new hearing must invalidate the cached transitions.
+	if err = db.AddHearingAndSongIfNeededAt("a", start.Add(601*time.Minute)); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	songs, err = db.Autoqueue("x", 1, AutoqueueOptions{})
+	if err != nil {
+		t.Fatalf("Could not generate queue: %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got queue %q, want %q", songs, want)
+	}
+
+	opts := AutoqueueOptions{Temperature: 1, Rand: rand.New(rand.NewSource(1))}
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		songs, err = db.Autoqueue("c", 2, opts)
+		if err != nil {
+			t.Fatalf("Could not generate queue: %v", err)
+		}
+		if len(songs) != 2 || songs[0] != "d" && songs[0] != "e" {
+			t.Fatalf("Got unexpected queue %q", songs)
+		}
+		seen[songs[0]] = true
+	}
+	if !seen["d"] || !seen["e"] {
+		t.Errorf("Only %v followed c at temperature 1", seen)
+	}
+
+	// Omitted songs are skipped.
+	songs, err = db.Autoqueue("b", 1, AutoqueueOptions{Omit: 48 * time.Hour})
+	if err != nil {
+		t.Fatalf("Could not generate queue: %v", err)
+	}
+	if len(songs) != 0 {
+		t.Errorf("Got queue %q, although all songs were omitted", songs)
+	}
+}
@@ -0,0 +1,80 @@
+package songmem
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MergeSongs merges the songs named from into the song named into. All
+// hearings of the merged songs become hearings of into and the merged
+// songs are removed. into keeps its artist, title and album, but takes
+// the earliest time any of the songs was added.
+//
+// The names and aliases of the merged songs become aliases of into, so
+// that hearings, which are registered under them later, count for into.
+//
+// Returns ErrSongNotFound, wrapped with the song's name, if one of the
+// songs does not exist. Nothing is changed, if merging fails.
+func (db SongDB) MergeSongs(from []string, into string) (err error) {
+	if len(from) == 0 {
+		return errors.New("no songs to merge given")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	intoID, err := songID(tx, into)
+	if err != nil {
+		return fmt.Errorf("%w: '%s'", err, into)
+	}
+	ids := []interface{}{intoID}
+	seen := map[int64]bool{intoID: true}
+	for _, name := range from {
+		id, err := songID(tx, name)
+		if err != nil {
+			return fmt.Errorf("%w: '%s'", err, name)
+		}
+		if id == intoID {
+			return fmt.Errorf("cannot merge '%s' into itself", name)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)-1), ",")
+	fromIDs := ids[1:]
+	_, err = tx.Exec(`UPDATE song SET (addedAt, addedAtUnix) = (
+	                      SELECT addedAt, addedAtUnix FROM song
+	                      WHERE id IN (?,`+placeholders+`)
+	                      ORDER BY addedAtUnix, id
+	                      LIMIT 1
+	                  )
+	                  WHERE id = ?`, append(ids, intoID)...)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(`UPDATE hearing SET songID = ?
+	                  WHERE songID IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(`UPDATE alias SET songID = ?
+	                  WHERE songID IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO alias(name, songID)
+	                  SELECT name, ? FROM song
+	                  WHERE id IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(`DELETE FROM song WHERE id IN (`+placeholders+`)`, fromIDs...)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
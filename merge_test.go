@@ -0,0 +1,70 @@
+package songmem
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMergeSongs(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Second)
+	hearings := []songHearing{
+		{"a", now.Add(-time.Hour)},
+		{"a (Remastered)", now.Add(-3 * time.Hour)},
+		{"a (Live)", now.Add(-2 * time.Hour)},
+		{"a (Live)", now.Add(-30 * time.Minute)},
+		{"b", now.Add(-4 * time.Hour)},
+	}
+	addHearings(t, db, hearings)
+	if err := db.RenameSong("a (Live)", "a"); err == nil {
+		t.Errorf("Renaming a song to an existing name did not fail")
+	}
+	if err := db.MergeSongs([]string{"a (Live)", "a (Remastered)", "a (Live)"}, "a"); err != nil {
+		t.Fatalf("Could not merge songs: %v", err)
+	}
+
+	songs, err := db.RankFavourites(QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not rank songs: %v", err)
+	}
+	want := []ScoredSong{{"a", 4, 4, now.Add(-30 * time.Minute)}, {"b", 1, 1, now.Add(-4 * time.Hour)}}
+	if len(songs) != len(want) {
+		t.Fatalf("Got %+v after merging, want %+v", songs, want)
+	}
+	for i := range want {
+		if songs[i].Name != want[i].Name || songs[i].HearingCount != want[i].HearingCount ||
+			!songs[i].LastHeard.Equal(want[i].LastHeard) {
+			t.Errorf("Got %+v after merging, want %+v", songs[i], want[i])
+		}
+	}
+	// a takes the time at which a (Remastered) was added.
+	var addedAtUnix int64
+	if err = db.QueryRow(`SELECT addedAtUnix FROM song WHERE name = 'a'`).Scan(&addedAtUnix); err != nil {
+		t.Fatalf("Could not query song: %v", err)
+	}
+	if want := now.Add(-3 * time.Hour).Unix(); addedAtUnix != want {
+		t.Errorf("Got addition at %d, want %d", addedAtUnix, want)
+	}
+
+	// The merged songs' names became aliases.
+	if err = db.AddHearingAndSongIfNeededAt("a (live)", now); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	songs, err = db.RankFavourites(QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not rank songs: %v", err)
+	}
+	if len(songs) != 2 || songs[0].HearingCount != 5 {
+		t.Errorf("Got %+v after hearing a merged song, want a with 5 hearings", songs)
+	}
+
+	if err = db.MergeSongs([]string{"b", "c"}, "a"); !errors.Is(err, ErrSongNotFound) {
+		t.Errorf("Got %v when merging an unknown song", err)
+	}
+	if err = db.MergeSongs([]string{"a"}, "a"); err == nil {
+		t.Errorf("Merging a song into itself did not fail")
+	}
+}
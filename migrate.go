@@ -0,0 +1,122 @@
+package songmem
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Migration is a change of the database schema. The schema version of
+// a database is the version of the last migration, that was applied to
+// it.
+type Migration struct {
+	Version     int
+	Description string
+	apply       func(db SongDB, tx *sql.Tx) error
+}
+
+// migrations must only ever be appended to. The version of each
+// migration is its position in the list, starting at 1.
+var migrations = []Migration{
+	{Description: "Create the song and hearing tables", apply: createBaseSchema},
+	{Description: "Store artist, title and album of songs", apply: addSongMetadataColumns},
+	{Description: "Store timestamps as unix time", apply: addUnixTimestamps},
+	{Description: "Index hearings by song and time", apply: addSongTimeIndex},
+	{Description: "Cache transitions between songs", apply: addTransitionCache},
+	{Description: "Track changes of songs for the search index", apply: addSongGeneration},
+	{Description: "Store aliases of songs", apply: addAliasTable},
+	{Description: "Change generations only once per outdated cache", apply: guardGenerationTriggers},
+}
+
+func init() {
+	for i := range migrations {
+		migrations[i].Version = i + 1
+	}
+}
+
+// SchemaVersion returns the schema version of the database. It is 0 for
+// new databases and databases, that were created before the schema was
+// versioned.
+func (db SongDB) SchemaVersion() (version int, err error) {
+	err = db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return
+}
+
+func (db SongDB) checkSchemaVersion() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("the database has schema version %d, but this "+
+			"version of songmem only supports up to version %d; please update",
+			version, len(migrations))
+	}
+	return nil
+}
+
+// PendingMigrations returns the migrations, that Migrate would apply.
+func (db SongDB) PendingMigrations() ([]Migration, error) {
+	if err := db.checkSchemaVersion(); err != nil {
+		return nil, err
+	}
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return migrations[version:], nil
+}
+
+// Migrate applies all pending migrations in a single transaction. If
+// the database is not empty, a backup of it is written next to the
+// database file first. Returns the applied migrations.
+func (db SongDB) Migrate() (applied []Migration, err error) {
+	pending, err := db.PendingMigrations()
+	if err != nil || len(pending) == 0 {
+		return
+	}
+	if err = db.backup(pending[0].Version - 1); err != nil {
+		return nil, fmt.Errorf("could not back up database: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for _, m := range pending {
+		if err = m.apply(db, tx); err != nil {
+			return nil, fmt.Errorf("migration %d failed: %v", m.Version, err)
+		}
+	}
+	// PRAGMA does not support placeholders.
+	last := pending[len(pending)-1].Version
+	if _, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, last)); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	return pending, nil
+}
+
+// backup writes a copy of the database next to the database file, if
+// the database is not empty.
+func (db SongDB) backup(version int) (err error) {
+	if db.path == "" || db.path == ":memory:" {
+		return
+	}
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master`).Scan(&tables)
+	if err != nil || tables == 0 {
+		return
+	}
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", db.path, version,
+		time.Now().Format("20060102T150405"))
+	if _, err = os.Stat(backupPath); err == nil {
+		return fmt.Errorf("backup '%s' already exists", backupPath)
+	}
+	_, err = db.Exec(`VACUUM INTO ?`, backupPath)
+	return
+}
@@ -0,0 +1,66 @@
+package songmem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "songmem")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "songmem.sql")
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("Could not initialize database: %v", err)
+	}
+	// An unversioned database, like those of old songmem versions.
+	if _, err = db.Exec(`CREATE TABLE song(
+	                         id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	                         name    TEXT NOT NULL,
+	                         addedAt TEXT NOT NULL,
+	                         CONSTRAINT name_unique UNIQUE(name COLLATE NOCASE)
+	                     )`); err != nil {
+		t.Fatalf("Could not create old schema: %v", err)
+	}
+
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		t.Fatalf("Could not list pending migrations: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Errorf("Got %d pending migrations, want %d", len(pending), len(migrations))
+	}
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Could not migrate: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	if version, _ := db.SchemaVersion(); version != len(migrations) {
+		t.Errorf("Got schema version %d, want %d", version, len(migrations))
+	}
+	backups, _ := filepath.Glob(path + ".v0-*.bak")
+	if len(backups) != 1 {
+		t.Errorf("Got backups %q, want exactly one", backups)
+	}
+	if applied, err = db.Migrate(); err != nil || len(applied) != 0 {
+		t.Errorf("Migrating again applied %d migrations with error %v", len(applied), err)
+	}
+
+	// Databases of newer songmem versions must not be touched.
+	if _, err = db.Exec(`PRAGMA user_version = 1000`); err != nil {
+		t.Fatalf("Could not set schema version: %v", err)
+	}
+	db.Close()
+	if db, err = InitDB(path); err == nil {
+		t.Errorf("Opened database of a newer version without error")
+	}
+	db.Close()
+}
@@ -0,0 +1,333 @@
+package songmem
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MPDWatcher registers hearings of the songs, that are played by an MPD
+// server. A hearing is only registered, once the song has been played
+// for MinShare of its duration or for MinTime, whichever comes first.
+// This way songs, that are skipped right away, are not registered.
+//
+// Songs are named "<artist><Separator><title>". If a song has no artist
+// tag, only its title is used and if it has no title tag, its file
+// name.
+type MPDWatcher struct {
+	// Addr is the address of the MPD server, like "localhost:6600".
+	Addr string
+
+	// Password is sent to the MPD server, if it is not empty.
+	Password string
+
+	// Separator separates the artist from the title in song names. If
+	// it is empty, DefaultSeparator is used.
+	Separator string
+
+	// MinShare is the share of a song's duration, after which a
+	// hearing is registered. 0.5 means, that half of the song must
+	// have been played.
+	MinShare float64
+
+	// MinTime is the time after which a hearing is registered, even if
+	// MinShare is not yet reached. It is also used, if the duration of
+	// a song is unknown.
+	MinTime time.Duration
+
+	// InitialBackoff is the time to wait before reconnecting after the
+	// connection to the MPD server was lost. It doubles with every
+	// failed attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Register is called with the song's name, when a hearing should be
+	// registered.
+	Register func(song string) error
+
+	// Logf reports errors, that do not stop the watcher. It may be nil.
+	Logf func(format string, args ...interface{})
+}
+
+// NewMPDWatcher returns an MPDWatcher, which registers hearings in db
+// using AddHearingAndSongIfNeeded and names songs with db's separator.
+// Like Last.fm, it registers hearings after half of the song or four
+// minutes.
+func NewMPDWatcher(db SongDB, addr string) *MPDWatcher {
+	return &MPDWatcher{
+		Addr:           addr,
+		Separator:      db.Separator,
+		MinShare:       0.5,
+		MinTime:        4 * time.Minute,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Register:       db.AddHearingAndSongIfNeeded,
+	}
+}
+
+// Watch watches the MPD server until ctx is done. If the connection is
+// lost, it reconnects with an exponential backoff. Watch only returns
+// ctx.Err().
+func (w *MPDWatcher) Watch(ctx context.Context) error {
+	backoff := w.InitialBackoff
+	for {
+		connected, err := w.watchConnection(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = w.InitialBackoff
+		}
+		w.logf("Connection to MPD failed: %v; reconnecting in %v", err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > w.MaxBackoff {
+			backoff = w.MaxBackoff
+		}
+	}
+}
+
+// mpdPlay describes a song, that is currently being played.
+type mpdPlay struct {
+	SongID     string
+	Name       string
+	Elapsed    time.Duration
+	Registered bool
+}
+
+func (w *MPDWatcher) watchConnection(ctx context.Context) (connected bool, err error) {
+	c, err := dialMPD(w.Addr, w.Password)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	connected = true
+
+	var play mpdPlay
+	for {
+		var status, song map[string]string
+		if status, err = c.command("status"); err != nil {
+			return
+		}
+		if song, err = c.command("currentsong"); err != nil {
+			return
+		}
+		wait := time.Duration(-1)
+		state := status["state"]
+		if state == "play" || state == "pause" {
+			elapsed, duration := mpdTimes(status)
+			if status["songid"] != play.SongID || mpdRepeated(status, play, elapsed) {
+				play = mpdPlay{SongID: status["songid"], Name: mpdSongName(song, w.separator())}
+			}
+			play.Elapsed = elapsed
+			threshold := w.threshold(duration)
+			if !play.Registered && elapsed >= threshold {
+				if !validName(play.Name) {
+					w.logf("Not registering hearing of invalid song name '%s'", play.Name)
+				} else if err := w.Register(play.Name); err != nil {
+					w.logf("Could not register hearing of %s: %v", play.Name, err)
+				}
+				play.Registered = true
+			} else if !play.Registered && state == "play" {
+				wait = threshold - elapsed
+			}
+		} else {
+			play = mpdPlay{}
+		}
+		if err = c.idle(ctx, wait); err != nil {
+			return
+		}
+	}
+}
+
+// mpdRestartTime is the elapsed time, below which a song, that jumped
+// back to its start, is considered to be played again.
+const mpdRestartTime = 5 * time.Second
+
+// mpdRepeated tells whether the song of play is played again, because
+// the repeat or single mode is enabled. Seeking backwards in a song
+// does not make it a new hearing.
+func mpdRepeated(status map[string]string, play mpdPlay, elapsed time.Duration) bool {
+	if status["repeat"] != "1" && status["single"] != "1" {
+		return false
+	}
+	return elapsed < play.Elapsed && elapsed < mpdRestartTime
+}
+
+// threshold returns the time a song must have been played, before a
+// hearing is registered. A duration of 0 means unknown.
+func (w *MPDWatcher) threshold(duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return w.MinTime
+	}
+	share := time.Duration(w.MinShare * float64(duration))
+	if w.MinTime > 0 && w.MinTime < share {
+		return w.MinTime
+	}
+	return share
+}
+
+func (w *MPDWatcher) logf(format string, args ...interface{}) {
+	if w.Logf != nil {
+		w.Logf(format, args...)
+	}
+}
+
+// mpdTimes extracts the elapsed time and the duration of the current
+// song from the response to the status command.
+func mpdTimes(status map[string]string) (elapsed, duration time.Duration) {
+	seconds := func(s string) time.Duration {
+		f, _ := strconv.ParseFloat(s, 64)
+		return time.Duration(f * float64(time.Second))
+	}
+	elapsed = seconds(status["elapsed"])
+	duration = seconds(status["duration"])
+	if t := strings.SplitN(status["time"], ":", 2); len(t) == 2 {
+		// Older MPD versions only report integer seconds.
+		if elapsed == 0 {
+			elapsed = seconds(t[0])
+		}
+		if duration == 0 {
+			duration = seconds(t[1])
+		}
+	}
+	return
+}
+
+func (w *MPDWatcher) separator() string {
+	if w.Separator == "" {
+		return DefaultSeparator
+	}
+	return w.Separator
+}
+
+func mpdSongName(song map[string]string, sep string) string {
+	name := song["Title"]
+	if name == "" {
+		file := path.Base(song["file"])
+		name = strings.TrimSuffix(file, path.Ext(file))
+	} else if song["Artist"] != "" {
+		name = song["Artist"] + sep + name
+	}
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// mpdCommandTimeout is the time an MPD server has to answer a command,
+// before the connection is considered dead.
+const mpdCommandTimeout = 10 * time.Second
+
+type mpdConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialMPD(addr, password string) (*mpdConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, mpdCommandTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &mpdConn{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(mpdCommandTimeout))
+	greeting, err := c.r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting '%s'", strings.TrimSpace(greeting))
+	}
+	if password != "" {
+		if _, err = c.command("password " + mpdQuote(password)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *mpdConn) Close() error {
+	return c.conn.Close()
+}
+
+// command sends the command and returns the key-value pairs of the
+// response. If a key occurs multiple times, the first value is kept.
+func (c *mpdConn) command(cmd string) (map[string]string, error) {
+	c.conn.SetDeadline(time.Now().Add(mpdCommandTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return nil, err
+	}
+	return c.readResponse()
+}
+
+// idle waits until the player changes state or wait has passed. A
+// negative wait means no timeout.
+func (c *mpdConn) idle(ctx context.Context, wait time.Duration) error {
+	c.conn.SetDeadline(time.Time{})
+	if _, err := fmt.Fprintf(c.conn, "idle player\n"); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.readResponse()
+		done <- err
+	}()
+	var timeout <-chan time.Time
+	if wait >= 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-timeout:
+		// MPD answers noidle by ending the idle command.
+		if _, err := fmt.Fprintf(c.conn, "noidle\n"); err != nil {
+			return err
+		}
+		return <-done
+	case <-ctx.Done():
+		c.conn.Close()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (c *mpdConn) readResponse() (map[string]string, error) {
+	pairs := make(map[string]string)
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "OK" {
+			return pairs, nil
+		}
+		if strings.HasPrefix(line, "ACK ") {
+			return nil, errors.New(strings.TrimPrefix(line, "ACK "))
+		}
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed response line '%s'", line)
+		}
+		if _, exists := pairs[kv[0]]; !exists {
+			pairs[kv[0]] = kv[1]
+		}
+	}
+}
+
+func mpdQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
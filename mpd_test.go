@@ -0,0 +1,302 @@
+package songmem
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMPD is a minimal MPD server, that supports just enough commands
+// for the MPDWatcher.
+type fakeMPD struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	songID   int
+	artist   string
+	title    string
+	duration time.Duration
+	started  time.Time
+	repeat   bool
+	version  int           // Incremented, when the player state changes.
+	changed  chan struct{} // Closed, when the player state changes.
+	conns    []net.Conn
+
+	statusVersion int           // The version, when the status was last requested.
+	statusPolled  chan struct{} // Closed, when the status is requested.
+}
+
+func newFakeMPD(t *testing.T) *fakeMPD {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	f := &fakeMPD{ln: ln, changed: make(chan struct{}), statusPolled: make(chan struct{})}
+	go f.serve()
+	return f
+}
+
+func (f *fakeMPD) play(artist, title string, duration time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.songID++
+	f.artist, f.title, f.duration = artist, title, duration
+	f.started = time.Now()
+	f.notifyChange()
+}
+
+// seek jumps to the given position in the current song.
+func (f *fakeMPD) seek(elapsed time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started = time.Now().Add(-elapsed)
+	f.notifyChange()
+}
+
+// setRepeat enables or disables the repeat mode. Like in MPD, this does
+// not change the player state.
+func (f *fakeMPD) setRepeat(repeat bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.repeat = repeat
+}
+
+// notifyChange must be called with f.mu locked.
+func (f *fakeMPD) notifyChange() {
+	f.version++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// awaitStatus waits until the status was requested after the last
+// change of the player state, so that the watcher has seen it.
+func (f *fakeMPD) awaitStatus(t *testing.T) {
+	timeout := time.After(2 * time.Second)
+	for {
+		f.mu.Lock()
+		seen, polled := f.statusVersion == f.version, f.statusPolled
+		f.mu.Unlock()
+		if seen {
+			return
+		}
+		select {
+		case <-polled:
+		case <-timeout:
+			t.Fatalf("The status was not requested after the last change")
+		}
+	}
+}
+
+// dropConnections closes all client connections, as if MPD restarted.
+func (f *fakeMPD) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeMPD) Close() {
+	f.ln.Close()
+	f.dropConnections()
+}
+
+func (f *fakeMPD) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeMPD) handle(conn net.Conn) {
+	defer conn.Close()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	fmt.Fprint(conn, "OK MPD 0.21.0\n")
+	// Like MPD, report changes, that happened between idle commands.
+	f.mu.Lock()
+	seenVersion := f.version
+	f.mu.Unlock()
+	for line := range lines {
+		f.mu.Lock()
+		changed := f.changed
+		if f.version != seenVersion {
+			changed = make(chan struct{})
+			close(changed)
+		}
+		var response string
+		switch line {
+		case "status":
+			repeat := 0
+			if f.repeat {
+				repeat = 1
+			}
+			if f.songID > 0 {
+				elapsed := time.Since(f.started).Seconds()
+				response = fmt.Sprintf("repeat: %d\nstate: play\nsongid: %d\nelapsed: %.3f\nduration: %.3f\n",
+					repeat, f.songID, elapsed, f.duration.Seconds())
+			} else {
+				response = fmt.Sprintf("repeat: %d\nstate: stop\n", repeat)
+			}
+			f.statusVersion = f.version
+			close(f.statusPolled)
+			f.statusPolled = make(chan struct{})
+		case "currentsong":
+			if f.songID > 0 {
+				response = fmt.Sprintf("file: %s.mp3\nArtist: %s\nTitle: %s\n",
+					f.title, f.artist, f.title)
+			}
+		case "idle player":
+			f.mu.Unlock()
+			select {
+			case <-changed:
+				response = "changed: player\n"
+			case line, ok := <-lines:
+				if !ok {
+					return
+				} else if line != "noidle" {
+					fmt.Fprint(conn, "ACK [5@0] {} expected noidle\n")
+					return
+				}
+			}
+			f.mu.Lock()
+			seenVersion = f.version
+		}
+		f.mu.Unlock()
+		fmt.Fprint(conn, response+"OK\n")
+	}
+}
+
+func TestMPDWatcher(t *testing.T) {
+	mpd := newFakeMPD(t)
+	defer mpd.Close()
+
+	registered := make(chan string, 10)
+	logged := make(chan string, 10)
+	w := &MPDWatcher{
+		Addr:           mpd.ln.Addr().String(),
+		MinShare:       0.5,
+		MinTime:        200 * time.Millisecond,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+		Register: func(song string) error {
+			registered <- song
+			return nil
+		},
+		Logf: func(format string, args ...interface{}) {
+			t.Logf(format, args...)
+			select {
+			case logged <- fmt.Sprintf(format, args...):
+			default:
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- w.Watch(ctx) }()
+
+	expect := func(want string) {
+		select {
+		case got := <-registered:
+			if got != want {
+				t.Errorf("Registered %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q was not registered", want)
+		}
+	}
+
+	// Skipped songs are not registered.
+	mpd.play("Foo", "Skipped", time.Minute)
+	mpd.awaitStatus(t)
+	mpd.play("Foo", "Heard long enough", time.Minute)
+	expect("Foo - Heard long enough")
+
+	// Seeking backwards does not register the song again.
+	mpd.seek(0)
+	mpd.awaitStatus(t)
+	mpd.seek(30 * time.Second)
+	mpd.awaitStatus(t)
+
+	// With repeat, a song, that starts over, is registered again.
+	mpd.play("Foo", "Repeated", time.Minute)
+	expect("Foo - Repeated")
+	mpd.setRepeat(true)
+	mpd.seek(0)
+	mpd.awaitStatus(t)
+	mpd.seek(30 * time.Second)
+	expect("Foo - Repeated")
+	mpd.setRepeat(false)
+
+	// Songs with names, that are too long, are not registered.
+	mpd.play("Foo", strings.Repeat("x", MaxNameLength), 100*time.Millisecond)
+	for msg := ""; !strings.Contains(msg, "invalid song name"); {
+		select {
+		case msg = <-logged:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("The song with the long name was not rejected")
+		}
+	}
+
+	// Short songs are registered after MinShare.
+	mpd.play("Foo", "Short", 100*time.Millisecond)
+	expect("Foo - Short")
+
+	// The watcher reconnects, after MPD restarted.
+	mpd.dropConnections()
+	mpd.play("Foo", "After restart", time.Minute)
+	expect("Foo - After restart")
+
+	cancel()
+	select {
+	case err := <-watchErr:
+		if err != context.Canceled {
+			t.Errorf("Watch returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Watch did not return after cancellation")
+	}
+	select {
+	case song := <-registered:
+		t.Errorf("Unexpectedly registered %q", song)
+	default:
+	}
+}
+
+func TestMPDSongName(t *testing.T) {
+	tests := []struct {
+		song map[string]string
+		sep  string
+		want string
+	}{
+		{map[string]string{"Artist": "Foo", "Title": "Bar", "file": "x.mp3"}, " - ", "Foo - Bar"},
+		{map[string]string{"Title": "Bar", "file": "x.mp3"}, " - ", "Bar"},
+		{map[string]string{"file": "Foo/Foo - Baz.flac"}, " - ", "Foo - Baz"},
+		{map[string]string{"Artist": "Foo", "Title": " Bar\n Baz "}, " - ", "Foo - Bar Baz"},
+		{map[string]string{"Artist": "Foo", "Title": "Bar"}, " / ", "Foo / Bar"},
+	}
+	for _, test := range tests {
+		if got := mpdSongName(test.song, test.sep); got != test.want {
+			t.Errorf("mpdSongName(%v, %q) = %q, want %q", test.song, test.sep, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package songmem
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultFrecencyHalfLife is the age at which a hearing counts half
+	// as much towards the frecency of a song as a hearing from now.
+	DefaultFrecencyHalfLife = 30 * 24 * time.Hour
+
+	// DefaultSuggestionHalfLife is the time between hearings, at which
+	// they count half as much towards the correlation of two songs as
+	// simultaneous hearings.
+	DefaultSuggestionHalfLife = 60 * time.Minute
+)
+
+// QueryOptions adjust which songs are ranked and how. The zero value
+// ranks all songs with the default settings.
+type QueryOptions struct {
+	// Omit excludes songs, that were heard within this timespan before
+	// now.
+	Omit time.Duration
+
+	// FrecencyHalfLife replaces DefaultFrecencyHalfLife, if it is not
+	// nil. It must be between one hour and 100 years.
+	FrecencyHalfLife *time.Duration
+
+	// SuggestionHalfLife replaces DefaultSuggestionHalfLife, if it is
+	// not nil. It must be between one minute and 30 days.
+	SuggestionHalfLife *time.Duration
+
+	// Since and Until limit the hearings, that are considered, to those
+	// between them. When listing songs in order of their addition, they
+	// limit when the songs were added instead. Zero values mean, that
+	// there is no limit.
+	Since time.Time
+	Until time.Time
+
+	// Offset skips the first songs of a list. Limit is the maximum
+	// number of songs in a list; 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// Validate checks whether the options are sensible.
+func (opts QueryOptions) Validate() error {
+	if opts.Omit < 0 {
+		return errors.New("the omit timespan is negative")
+	}
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return errors.New("the offset and limit must not be negative")
+	}
+	if !opts.Since.IsZero() && !opts.Until.IsZero() && opts.Since.After(opts.Until) {
+		return errors.New("since is after until")
+	}
+	const century = 100 * 365 * 24 * time.Hour
+	if opts.FrecencyHalfLife != nil &&
+		(*opts.FrecencyHalfLife < time.Hour || *opts.FrecencyHalfLife > century) {
+		return errors.New("the frecency half-life must be between 1h and 100 years")
+	}
+	if opts.SuggestionHalfLife != nil &&
+		(*opts.SuggestionHalfLife < time.Minute || *opts.SuggestionHalfLife > 30*24*time.Hour) {
+		return errors.New("the suggestion half-life must be between 1m and 30 days")
+	}
+	return nil
+}
+
+// bounds returns Since and Until as unix time. See unixBounds.
+func (opts QueryOptions) bounds() (since, until int64) {
+	return unixBounds(opts.Since, opts.Until)
+}
+
+// sqlLimit returns the LIMIT and OFFSET for SQL queries. SQLite treats
+// a negative LIMIT as no limit.
+func (opts QueryOptions) sqlLimit() (limit, offset int) {
+	if opts.Limit == 0 {
+		return -1, opts.Offset
+	}
+	return opts.Limit, opts.Offset
+}
+
+func (opts QueryOptions) frecencyHalfLife() time.Duration {
+	if opts.FrecencyHalfLife == nil {
+		return DefaultFrecencyHalfLife
+	}
+	return *opts.FrecencyHalfLife
+}
+
+func (opts QueryOptions) suggestionHalfLife() time.Duration {
+	if opts.SuggestionHalfLife == nil {
+		return DefaultSuggestionHalfLife
+	}
+	return *opts.SuggestionHalfLife
+}
+
+// Aggregation determines, how the correlations of a song to multiple
+// seeds are combined into one score.
+type Aggregation string
+
+const (
+	// AggregateSum adds the correlations to all seeds.
+	AggregateSum Aggregation = "sum"
+
+	// AggregateMax uses the highest correlation to any seed.
+	AggregateMax Aggregation = "max"
+
+	// AggregateGeometricMean uses the geometric mean of the correlations,
+	// which favours songs, that are correlated to all seeds. Songs, that
+	// are not correlated to every seed, are left out.
+	AggregateGeometricMean Aggregation = "geomean"
+)
+
+// Direction selects, which hearings count towards the correlation of a
+// song to a seed.
+type Direction string
+
+const (
+	// DirectionBoth counts hearings before and after the seed's hearings.
+	DirectionBoth Direction = "both"
+
+	// DirectionBefore only counts hearings before the seed's hearings,
+	// to find songs, that lead to the seed.
+	DirectionBefore Direction = "before"
+
+	// DirectionAfter only counts hearings after the seed's hearings, to
+	// find songs, that typically follow the seed.
+	DirectionAfter Direction = "after"
+)
+
+// SuggestionOptions adjust how suggestions for multiple seeds are
+// ranked. The zero value ranks all songs by the sum of their
+// correlations to the seeds, with the default settings.
+type SuggestionOptions struct {
+	QueryOptions
+
+	// Aggregation defaults to AggregateSum, if it is empty.
+	Aggregation Aggregation
+
+	// Weights are the weights of the seeds, in the same order as the
+	// seeds. The correlations to each seed are multiplied by its weight,
+	// before they are combined; for AggregateGeometricMean, the weights
+	// are the exponents of a weighted geometric mean. If Weights is nil,
+	// all seeds have the weight 1.
+	Weights []float64
+
+	// Direction defaults to DirectionBoth, if it is empty.
+	Direction Direction
+
+	// SessionGap is the longest pause between two hearings of the same
+	// listening session. If it is set, only hearings in the same session
+	// as a hearing of the seed count. If it is zero, sessions are
+	// ignored.
+	SessionGap time.Duration
+}
+
+// Validate checks whether the options are sensible.
+func (opts SuggestionOptions) Validate() error {
+	if err := opts.QueryOptions.Validate(); err != nil {
+		return err
+	}
+	switch opts.Aggregation {
+	case "", AggregateSum, AggregateMax, AggregateGeometricMean:
+	default:
+		return fmt.Errorf("unknown aggregation '%s'", opts.Aggregation)
+	}
+	switch opts.Direction {
+	case "", DirectionBoth, DirectionBefore, DirectionAfter:
+	default:
+		return fmt.Errorf("unknown direction '%s'", opts.Direction)
+	}
+	if opts.SessionGap < 0 {
+		return errors.New("the session gap is negative")
+	}
+	for _, w := range opts.Weights {
+		if !(w > 0) || math.IsInf(w, 1) {
+			return fmt.Errorf("invalid weight %g; weights must be positive", w)
+		}
+	}
+	return nil
+}
+
+// SearchOptions adjust which of the songs, that match a search, are
+// listed.
+type SearchOptions struct {
+	// Offset skips the first matches. Limit is the maximum number of
+	// matches; 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// Validate checks whether the options are sensible.
+func (opts SearchOptions) Validate() error {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return errors.New("the offset and limit must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryOptionsValidate(t *testing.T) {
+	duration := func(d time.Duration) *time.Duration { return &d }
+	tests := []struct {
+		opts  QueryOptions
+		valid bool
+	}{
+		{QueryOptions{}, true},
+		{QueryOptions{FrecencyHalfLife: duration(7 * 24 * time.Hour), SuggestionHalfLife: duration(15 * time.Minute)}, true},
+		{QueryOptions{Omit: -time.Hour}, false},
+		{QueryOptions{FrecencyHalfLife: duration(-time.Hour)}, false},
+		{QueryOptions{FrecencyHalfLife: duration(0)}, false},
+		{QueryOptions{FrecencyHalfLife: duration(time.Minute)}, false},
+		{QueryOptions{SuggestionHalfLife: duration(0)}, false},
+		{QueryOptions{SuggestionHalfLife: duration(time.Second)}, false},
+		{QueryOptions{SuggestionHalfLife: duration(365 * 24 * time.Hour)}, false},
+	}
+	for _, test := range tests {
+		if err := test.opts.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate() of %+v returned %v", test.opts, err)
+		}
+	}
+}
+
+func TestFrecencyHalfLife(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	hearings := []songHearing{
+		{"old", now.Add(-10 * 24 * time.Hour)},
+		{"old", now.Add(-10 * 24 * time.Hour)},
+		{"new", now.Add(-time.Minute)},
+	}
+	addHearings(t, db, hearings)
+
+	day := 24 * time.Hour
+	for _, test := range []struct {
+		halfLife *time.Duration
+		want     string
+	}{
+		{nil, "old"},
+		{&day, "new"},
+	} {
+		opts := QueryOptions{FrecencyHalfLife: test.halfLife}
+		songs, err := db.RankFrecentSongs(opts)
+		if err != nil {
+			t.Fatalf("Could not rank songs: %v", err)
+		}
+		if songs[0].Name != test.want {
+			t.Errorf("Got %q as most frecent song with half-life %v, want %q",
+				songs[0].Name, opts.frecencyHalfLife(), test.want)
+		}
+	}
+}
+
+func TestSinceUntil(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	summer := time.Date(2020, time.July, 1, 12, 0, 0, 0, time.UTC)
+	hearings := []songHearing{
+		{"spring", summer.AddDate(0, -3, 0)},
+		{"spring", summer.AddDate(0, -3, 1)},
+		{"summer", summer},
+		{"spring", summer.AddDate(0, 0, 1)},
+		{"summer", summer.AddDate(0, 0, 2)},
+		{"autumn", summer.AddDate(0, 3, 0)},
+	}
+	addHearings(t, db, hearings)
+
+	opts := QueryOptions{Since: summer.AddDate(0, -1, 0), Until: summer.AddDate(0, 2, 0)}
+	favourites, err := db.RankFavourites(opts)
+	if err != nil {
+		t.Fatalf("Could not rank favourites: %v", err)
+	}
+	if len(favourites) != 2 || favourites[0].Name != "summer" || favourites[0].HearingCount != 2 {
+		t.Errorf("Got favourites %+v of the summer, want summer and spring", favourites)
+	}
+	songs, err := db.ListSongsInOrderOfLastHearingWithOptions(opts)
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"summer", "spring"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got songs %q in order of last hearing, want %q", songs, want)
+	}
+	songs, err = db.ListSongsInOrderOfAdditionWithOptions(opts)
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"summer"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got songs %q added in summer, want %q", songs, want)
+	}
+	frecent, err := db.RankFrecentSongs(QueryOptions{Since: summer.AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatalf("Could not rank frecent songs: %v", err)
+	}
+	if len(frecent) != 1 || frecent[0].Name != "autumn" {
+		t.Errorf("Got frecent songs %+v since August, want autumn", frecent)
+	}
+
+	opts.Since, opts.Until = opts.Until, opts.Since
+	if _, err = db.RankFavourites(opts); err == nil {
+		t.Errorf("Ranking favourites with since after until did not fail")
+	}
+}
@@ -0,0 +1,190 @@
+package songmem
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PlaylistFormat identifies the format of a playlist.
+type PlaylistFormat string
+
+const (
+	// M3U8 is an extended M3U playlist in UTF-8. It contains the paths
+	// of the songs' files, relative to the music library's root.
+	M3U8 PlaylistFormat = "m3u8"
+
+	// XSPF is an XML shareable playlist. Songs are described by their
+	// artist and title and, if the file could be found in the music
+	// library, by the location of the file.
+	XSPF PlaylistFormat = "xspf"
+)
+
+// MusicLibrary is an index of the audio files below a directory.
+type MusicLibrary struct {
+	Root string
+
+	// Skipped holds the errors of the files and directories below
+	// Root, that could not be read. They are left out of the library.
+	Skipped []error
+
+	files map[string]string // Normalized song name to relative path.
+}
+
+// trackNumberPrefix matches track numbers at the start of file names,
+// like "01 - " or "1. ".
+var trackNumberPrefix = regexp.MustCompile(`^\d{1,3}\s*[-._]?\s+`)
+
+// ScanMusicLibrary indexes all audio files below root. Files are
+// indexed by their artist and title tags as "<artist><sep><title>". If
+// they have no tags, that could be read, they are indexed by their
+// file name without the extension and leading track numbers.
+//
+// Files and directories, that cannot be read, are skipped; see
+// MusicLibrary.Skipped. Fails only if root itself cannot be read.
+func ScanMusicLibrary(root, sep string) (*MusicLibrary, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	lib := &MusicLibrary{Root: root, files: make(map[string]string)}
+	byFilename := make(map[string]string)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil && path == root {
+			return err
+		} else if err != nil {
+			lib.Skipped = append(lib.Skipped, err)
+			return nil
+		}
+		if info.IsDir() || !isAudioFile(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if artist, title, err := readTags(path); err == nil {
+			name := title
+			if artist != "" {
+				name = artist + sep + title
+			}
+			if _, exists := lib.files[normalizeName(name)]; !exists {
+				lib.files[normalizeName(name)] = rel
+			}
+		}
+		base := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		base = trackNumberPrefix.ReplaceAllString(base, "")
+		if _, exists := byFilename[normalizeName(base)]; !exists {
+			byFilename[normalizeName(base)] = rel
+		}
+		return nil
+	})
+	// Tags are more reliable than file names, so they take precedence.
+	for name, rel := range byFilename {
+		if _, exists := lib.files[name]; !exists {
+			lib.files[name] = rel
+		}
+	}
+	return lib, err
+}
+
+// Resolve returns the path of the given song's file, relative to the
+// library's root.
+func (lib *MusicLibrary) Resolve(song string) (path string, ok bool) {
+	path, ok = lib.files[normalizeName(song)]
+	return
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// WritePlaylist writes the given songs, in order, as a playlist in the
+// given format to w. lib is used to find the songs' files. It is
+// required for M3U8 playlists and may be nil for XSPF playlists, which
+// name the artist and title of songs, split at sep.
+//
+// Returns the songs, whose files could not be found. They are left out
+// of M3U8 playlists.
+func WritePlaylist(w io.Writer, songs []string, format PlaylistFormat,
+	lib *MusicLibrary, sep string) (unresolved []string, err error) {
+	switch format {
+	case M3U8:
+		if lib == nil {
+			return nil, errors.New("M3U8 playlists require a music library")
+		}
+		return writeM3U8(w, songs, lib)
+	case XSPF:
+		return writeXSPF(w, songs, lib, sep)
+	}
+	return nil, fmt.Errorf("unknown playlist format '%s'", format)
+}
+
+func writeM3U8(w io.Writer, songs []string, lib *MusicLibrary) (unresolved []string, err error) {
+	if _, err = fmt.Fprintln(w, "#EXTM3U"); err != nil {
+		return
+	}
+	for _, song := range songs {
+		path, ok := lib.Resolve(song)
+		if !ok {
+			unresolved = append(unresolved, song)
+			continue
+		}
+		if _, err = fmt.Fprintf(w, "#EXTINF:-1,%s\n%s\n", song, path); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Title    string `xml:"title"`
+}
+
+func writeXSPF(w io.Writer, songs []string, lib *MusicLibrary, sep string) (unresolved []string, err error) {
+	playlist := xspfPlaylist{Version: "1"}
+	for _, song := range songs {
+		var track xspfTrack
+		track.Creator, track.Title = SplitSongName(song, sep)
+		if path, ok := lib.resolveIfPresent(song); ok {
+			abs := filepath.Join(lib.Root, filepath.FromSlash(path))
+			u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+			track.Location = u.String()
+		} else {
+			unresolved = append(unresolved, song)
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(playlist); err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(w)
+	return
+}
+
+func (lib *MusicLibrary) resolveIfPresent(song string) (path string, ok bool) {
+	if lib == nil {
+		return "", false
+	}
+	return lib.Resolve(song)
+}
@@ -0,0 +1,130 @@
+package songmem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWritePlaylistM3U8(t *testing.T) {
+	root, err := ioutil.TempDir("", "songmem")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string][]byte{
+		"Foo/tagged.flac":        flacWithComments("ARTIST=Foo", "TITLE=Bar"),
+		"Foo/01 - Foo - Baz.ogg": nil,
+		"Foo/cover.jpg":          nil,
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Could not create directory: %v", err)
+		}
+		if err = ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Could not write file: %v", err)
+		}
+	}
+
+	lib, err := ScanMusicLibrary(root, DefaultSeparator)
+	if err != nil {
+		t.Fatalf("Could not scan music library: %v", err)
+	}
+	var playlist bytes.Buffer
+	songs := []string{"foo - bar", "Foo - Baz", "Foo - Qux"}
+	unresolved, err := WritePlaylist(&playlist, songs, M3U8, lib, DefaultSeparator)
+	if err != nil {
+		t.Fatalf("Could not write playlist: %v", err)
+	}
+	want := "#EXTM3U\n" +
+		"#EXTINF:-1,foo - bar\nFoo/tagged.flac\n" +
+		"#EXTINF:-1,Foo - Baz\nFoo/01 - Foo - Baz.ogg\n"
+	if playlist.String() != want {
+		t.Errorf("Got playlist\n%s\nwant\n%s", playlist.String(), want)
+	}
+	if !reflect.DeepEqual(unresolved, []string{"Foo - Qux"}) {
+		t.Errorf("Got unresolved songs %q, want %q", unresolved, "Foo - Qux")
+	}
+}
+
+func TestWritePlaylistXSPF(t *testing.T) {
+	var playlist bytes.Buffer
+	unresolved, err := WritePlaylist(&playlist, []string{"Foo / Bar - Baz", "Qux"}, XSPF, nil, " / ")
+	if err != nil {
+		t.Fatalf("Could not write playlist: %v", err)
+	}
+	for _, want := range []string{
+		"<creator>Foo</creator>\n      <title>Bar - Baz</title>",
+		"<track>\n      <title>Qux</title>",
+	} {
+		if !strings.Contains(playlist.String(), want) {
+			t.Errorf("Playlist\n%s\ndoes not contain\n%s", playlist.String(), want)
+		}
+	}
+	if len(unresolved) != 2 {
+		t.Errorf("Got unresolved songs %q, want both songs", unresolved)
+	}
+}
+
+func flacWithComments(comments ...string) []byte {
+	var block bytes.Buffer
+	binary.Write(&block, binary.LittleEndian, uint32(0)) // Empty vendor.
+	binary.Write(&block, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&block, binary.LittleEndian, uint32(len(c)))
+		block.WriteString(c)
+	}
+	size := block.Len()
+	header := []byte{0x80 | 4, byte(size >> 16), byte(size >> 8), byte(size)}
+	return append(append([]byte("fLaC"), header...), block.Bytes()...)
+}
+
+func TestReadID3v2(t *testing.T) {
+	frame := func(id, text string) []byte {
+		size := len(text) + 1
+		header := []byte(id)
+		header = append(header, byte(size>>21), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f), 0, 0)
+		return append(append(header, 3), text...) // 3 is UTF-8.
+	}
+	var tag bytes.Buffer
+	tag.Write(frame("TXXX", "ignored"))
+	tag.Write(frame("TPE1", "Foo"))
+	tag.Write(frame("TIT2", "Bar"))
+	// A picture, that claims to be far larger than the file.
+	tag.Write([]byte{'A', 'P', 'I', 'C', 0x7f, 0x7f, 0x7f, 0x7f, 0, 0})
+	header := []byte{'I', 'D', '3', 4, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f}
+
+	tags, err := readID3v2(bytes.NewReader(append(header, tag.Bytes()...)))
+	if err != nil {
+		t.Fatalf("Could not read tags: %v", err)
+	}
+	want := map[string]string{"ARTIST": "Foo", "TITLE": "Bar"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Got tags %q, want %q", tags, want)
+	}
+}
+
+func TestReadFLACComments(t *testing.T) {
+	// A picture block precedes the comments.
+	picture := append([]byte{6, 0, 0x10, 0}, make([]byte, 0x1000)...)
+	flac := append([]byte("fLaC"), picture...)
+	flac = append(flac, flacWithComments("ARTIST=Foo", "TITLE=Bar")[4:]...)
+	tags, err := readFLACComments(bytes.NewReader(flac))
+	if err != nil {
+		t.Fatalf("Could not read tags: %v", err)
+	}
+	if tags["ARTIST"] != "Foo" || tags["TITLE"] != "Bar" {
+		t.Errorf("Got tags %q, want artist Foo and title Bar", tags)
+	}
+
+	huge := append([]byte("fLaC"), 0x80|4, 0xff, 0xff, 0xff)
+	if _, err = readFLACComments(bytes.NewReader(huge)); err == nil {
+		t.Errorf("Reading comments, that are too large, did not fail")
+	}
+}
@@ -0,0 +1,276 @@
+package songmem
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ErrSongNotFound is returned, when a song is looked up by its name,
+// but there is no song with this name. Use SearchSongs to find songs
+// with similar names.
+var ErrSongNotFound = errors.New("song not found")
+
+// songID returns the ID of the song with the given name.
+func songID(e execQueryer, name string) (id int64, err error) {
+	err = e.QueryRow(`SELECT id FROM song WHERE name = ?`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = ErrSongNotFound
+	}
+	return
+}
+
+// SearchSongs ranks the songs, whose names contain all words of query.
+// Words of the query also match the beginning of words in song names
+// and, if they are long enough, words with a typo or two. Songs named
+// exactly like the query are ranked first.
+//
+// If songmem is built with the sqlite_fts5 build tag, songs are looked
+// up in a full-text index first; only if there are no matches there,
+// all songs are searched for similar names. HearingCount and LastHeard
+// are set for the matches.
+func (db SongDB) SearchSongs(query string, opts SearchOptions) (songs []ScoredSong, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	words := searchWords(query)
+	if len(words) == 0 {
+		return nil, errors.New("the query is empty")
+	}
+	scores, err := db.fullTextSearch(words)
+	if err != nil {
+		return
+	}
+	if len(scores) == 0 {
+		if scores, err = db.fuzzySearch(words); err != nil {
+			return
+		}
+	}
+	best := 0.0
+	for _, score := range scores {
+		if score > best {
+			best = score
+		}
+	}
+	for name := range scores {
+		if strings.EqualFold(name, strings.TrimSpace(query)) {
+			scores[name] = best + 1
+		}
+	}
+	songs = rankSongs(scores, nil, opts.Offset, opts.Limit)
+	return songs, db.setHearingStats(songs, math.MinInt64, math.MaxInt64)
+}
+
+// searchWords splits s into lower case words, ignoring punctuation.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// fullTextSearch scores the songs, whose names contain words starting
+// with every word, using the full-text index. It returns no scores, if
+// SQLite was built without FTS5.
+func (db SongDB) fullTextSearch(words []string) (scores map[string]float64, err error) {
+	ok, err := db.updateSearchIndex()
+	if err != nil || !ok {
+		return
+	}
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + strings.Replace(w, `"`, `""`, -1) + `"*`
+	}
+	// bm25 is lower for better matches.
+	rows, err := db.Query(`SELECT song.name, -bm25(songSearch) FROM songSearch
+	                       INNER JOIN song ON song.id = songSearch.rowid
+	                       WHERE songSearch MATCH ?`, strings.Join(terms, " "))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	scores = make(map[string]float64)
+	for rows.Next() {
+		var name string
+		var score float64
+		if err = rows.Scan(&name, &score); err != nil {
+			return
+		}
+		scores[name] = score
+	}
+	return scores, rows.Err()
+}
+
+// updateSearchIndex creates the full-text index, if it does not exist
+// yet, and rebuilds it, if songs changed since it was built. Returns
+// false, if SQLite was built without FTS5.
+func (db SongDB) updateSearchIndex() (ok bool, err error) {
+	err = db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&ok)
+	if err != nil || !ok {
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS songSearch USING fts5(
+	                      name, content='song', content_rowid='id',
+	                      tokenize='unicode61 remove_diacritics 2'
+	                  )`)
+	if err != nil {
+		return
+	}
+	var generation, builtGeneration int64
+	err = tx.QueryRow(`SELECT songGeneration.generation, searchIndexInfo.generation
+	                   FROM songGeneration, searchIndexInfo`).Scan(
+		&generation, &builtGeneration)
+	if err != nil || generation == builtGeneration {
+		return
+	}
+	if _, err = tx.Exec(`INSERT INTO songSearch(songSearch) VALUES ('rebuild')`); err != nil {
+		return
+	}
+	_, err = tx.Exec(`UPDATE searchIndexInfo SET generation = ?`, generation)
+	if err != nil {
+		return
+	}
+	return true, tx.Commit()
+}
+
+// fuzzySearch scores all songs by how well the words of their names
+// match words.
+func (db SongDB) fuzzySearch(words []string) (scores map[string]float64, err error) {
+	rows, err := db.Query(`SELECT name FROM song`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	scores = make(map[string]float64)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		if score, ok := fuzzyScore(words, searchWords(name)); ok {
+			scores[name] = score
+		}
+	}
+	return scores, rows.Err()
+}
+
+// fuzzyScore is the mean of how well every word of query matches its
+// best matching word of name. A word matches best, if it is equal,
+// then, if it is the beginning of the word, then, if it is contained in
+// it. Otherwise, it matches the less, the more typos there are. ok is
+// false, if a word does not match at all.
+func fuzzyScore(query, name []string) (score float64, ok bool) {
+	for _, q := range query {
+		typos := maxTypos(len([]rune(q)))
+		var best float64
+		for _, w := range name {
+			var s float64
+			switch {
+			case w == q:
+				s = 1
+			case strings.HasPrefix(w, q):
+				s = 0.8
+			case strings.Contains(w, q):
+				s = 0.6
+			default:
+				if d := editDistance(q, w); d <= typos {
+					s = 0.5 / float64(d)
+				}
+			}
+			if s > best {
+				best = s
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+	}
+	return score / float64(len(query)), true
+}
+
+// editDistance returns the number of runes, that need to be inserted,
+// deleted or replaced, and of adjacent runes, that need to be swapped,
+// to turn a into b. A swapped pair of runes, like in "beatlse", counts
+// as a single typo.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && prevPrev[j-2]+1 < cur[j] {
+				cur[j] = prevPrev[j-2] + 1
+			}
+		}
+		prevPrev, prev, cur = prev, cur, prevPrev
+	}
+	return prev[len(rb)]
+}
+
+// maxTypos is the number of typos, that a query word of n runes may
+// have: none for short words, one from five runes and two from nine.
+func maxTypos(n int) int {
+	switch {
+	case n >= 9:
+		return 2
+	case n >= 5:
+		return 1
+	}
+	return 0
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// addSongGeneration adds a generation, that is increased by triggers,
+// whenever songs are added, renamed or removed, so that the full-text
+// index can be rebuilt when it is outdated.
+//
+// The full-text index itself is only created by builds with FTS5, so
+// that the database stays usable by builds without it.
+func addSongGeneration(db SongDB, tx *sql.Tx) (err error) {
+	commands := [...]string{
+		`CREATE TABLE songGeneration(generation INTEGER NOT NULL)`,
+		`INSERT INTO songGeneration VALUES (1)`,
+		`CREATE TABLE searchIndexInfo(generation INTEGER NOT NULL)`,
+		`INSERT INTO searchIndexInfo VALUES (0)`,
+		`CREATE TRIGGER song_insert AFTER INSERT ON song BEGIN
+		     UPDATE songGeneration SET generation = generation + 1;
+		 END`,
+		`CREATE TRIGGER song_update AFTER UPDATE OF name ON song BEGIN
+		     UPDATE songGeneration SET generation = generation + 1;
+		 END`,
+		`CREATE TRIGGER song_delete AFTER DELETE ON song BEGIN
+		     UPDATE songGeneration SET generation = generation + 1;
+		 END`}
+	for _, c := range commands {
+		if _, err = tx.Exec(c); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFullTextSearch(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for _, song := range []string{"The Beatles - Yesterday", "Beatles Tribute - Yesterday"} {
+		if err := db.AddHearingAndSongIfNeededAt(song, now); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	scores, err := db.fullTextSearch([]string{"beat", "yesterday"})
+	if err != nil {
+		t.Fatalf("Could not search songs: %v", err)
+	}
+	if len(scores) != 2 {
+		t.Errorf("Got %d full-text matches, want 2", len(scores))
+	}
+
+	// The index is rebuilt after songs change.
+	if err = db.RenameSong("The Beatles - Yesterday", "The Beatles - Help"); err != nil {
+		t.Fatalf("Could not rename song: %v", err)
+	}
+	songs, err := db.SearchSongs("beatles help", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Could not search songs: %v", err)
+	}
+	if got := scoredSongsToNames(songs); !reflect.DeepEqual(got, []string{"The Beatles - Help"}) {
+		t.Errorf("Got %q after renaming, want the renamed song", got)
+	}
+
+	// Typos are still found by the fuzzy search.
+	songs, err = db.SearchSongs("beatlse", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Could not search songs: %v", err)
+	}
+	if len(songs) != 2 {
+		t.Errorf("Got %q for a typo, want both songs", scoredSongsToNames(songs))
+	}
+}
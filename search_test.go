@@ -0,0 +1,96 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchSongs(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for _, song := range []string{
+		"The Beatles - Yesterday",
+		"The Beatles - Let It Be",
+		"Beatles Tribute - Yesterday",
+		"Simon & Garfunkel - The Boxer",
+		"Yesterday",
+	} {
+		if err := db.AddHearingAndSongIfNeededAt(song, now); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"yesterday beatles", []string{"Beatles Tribute - Yesterday", "The Beatles - Yesterday"}},
+		{"Yesterday", []string{"Yesterday", "Beatles Tribute - Yesterday", "The Beatles - Yesterday"}},
+		{"beat let", []string{"The Beatles - Let It Be"}},
+		{"the beatles - yesterday", []string{"The Beatles - Yesterday"}},
+		{"Beatles - Yesterdy", []string{"Beatles Tribute - Yesterday", "The Beatles - Yesterday"}},
+		{"garfunkle boxer", []string{"Simon & Garfunkel - The Boxer"}},
+		{"beatlse", []string{"Beatles Tribute - Yesterday", "The Beatles - Let It Be", "The Beatles - Yesterday"}},
+		{"bet", []string{}}, // Too short for a typo.
+	}
+	for _, test := range tests {
+		songs, err := db.SearchSongs(test.query, SearchOptions{})
+		if err != nil {
+			t.Fatalf("Could not search songs: %v", err)
+		}
+		if got := scoredSongsToNames(songs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Got %q for %q, want %q", got, test.query, test.want)
+		}
+	}
+
+	songs, err := db.SearchSongs("beatles", SearchOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("Could not search songs: %v", err)
+	}
+	if len(songs) != 1 || songs[0].HearingCount != 1 {
+		t.Errorf("Got %+v with limit 1, want one song heard once", songs)
+	}
+}
+
+func TestErrSongNotFound(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if err := db.AddHearingAndSongIfNeeded("a"); err != nil {
+		t.Fatalf("Could not add hearing: %v", err)
+	}
+	if err := db.AddHearing("b"); err != ErrSongNotFound {
+		t.Errorf("Got %v when adding a hearing of an unknown song", err)
+	}
+	if err := db.RemoveLastHearingOf("b"); err != ErrSongNotFound {
+		t.Errorf("Got %v when removing a hearing of an unknown song", err)
+	}
+	if err := db.RenameSong("b", "c"); err != ErrSongNotFound {
+		t.Errorf("Got %v when renaming an unknown song", err)
+	}
+	if _, err := db.RankSuggestions("b", QueryOptions{}); err != ErrSongNotFound {
+		t.Errorf("Got %v when ranking suggestions for an unknown song", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"yesterdy", "yesterday", 1},
+		{"beatlse", "beatles", 1},
+		{"ab", "ba", 1},
+		{"café", "cafe", 1},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("Got distance %d between %q and %q, want %d", got, test.a, test.b, test.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package songmem
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultSessionGap is the longest pause between two hearings, that
+// belong to the same listening session, if no other gap is given.
+const DefaultSessionGap = 30 * time.Minute
+
+// Session is a listening session: a series of hearings, where no pause
+// between two hearings is longer than the session gap.
+type Session struct {
+	// Number counts the sessions back from the latest one, which is
+	// number 1.
+	Number int
+
+	// Start and End are the times of the first and last hearing.
+	Start time.Time
+	End   time.Time
+
+	// Songs are the songs, that were heard, in order of their hearings.
+	// Songs, that were heard multiple times, are listed multiple times.
+	Songs []string
+}
+
+// ListSessions lists the listening sessions, that started between from
+// and to, oldest first, using DefaultSessionGap. See
+// ListSessionsWithGap.
+func (db SongDB) ListSessions(from, to time.Time) (sessions []Session, err error) {
+	return db.ListSessionsWithGap(from, to, DefaultSessionGap)
+}
+
+// ListSessionsWithGap lists the listening sessions, that started
+// between from and to, oldest first. A new session starts, whenever
+// nothing was heard for longer than gap. A zero from or to means, that
+// there is no limit.
+//
+// Sessions are found among all hearings, so that from and to do not cut
+// sessions off; the last session may end after to.
+func (db SongDB) ListSessionsWithGap(from, to time.Time, gap time.Duration) (sessions []Session, err error) {
+	return db.ListSessionsWithOptions(SessionOptions{Gap: gap, From: from, To: to})
+}
+
+// SessionOptions select, which listening sessions are listed.
+type SessionOptions struct {
+	// Gap is the longest pause between two hearings of a session. It
+	// must be positive.
+	Gap time.Duration
+
+	// From and To select only sessions, that started between them,
+	// inclusively. Zero values mean, that there is no limit.
+	From time.Time
+	To   time.Time
+
+	// NewestFirst lists the latest session first. The songs of each
+	// session stay in order of their hearings.
+	NewestFirst bool
+
+	// Offset skips the first sessions. Limit is the maximum number of
+	// sessions; 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// Validate returns an error, if opts cannot be used to list sessions.
+func (opts SessionOptions) Validate() error {
+	if opts.Gap <= 0 {
+		return errors.New("the session gap must be positive")
+	}
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return errors.New("the offset and limit must not be negative")
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.From.After(opts.To) {
+		return errors.New("from is after to")
+	}
+	return nil
+}
+
+// ListSessionsWithOptions lists the listening sessions, that are
+// selected by opts. Sessions are found among all hearings, so that
+// opts.From and opts.To do not cut sessions off.
+func (db SongDB) ListSessionsWithOptions(opts SessionOptions) (sessions []Session, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	fromUnix, toUnix := unixBounds(opts.From, opts.To)
+	limit, offset := QueryOptions{Offset: opts.Offset, Limit: opts.Limit}.sqlLimit()
+	order := "ASC"
+	if opts.NewestFirst {
+		order = "DESC"
+	}
+	rows, err := db.Query(`WITH pause AS (
+	                           SELECT id, songID, heardAt, heardAtUnix,
+	                                  heardAtUnix - LAG(heardAtUnix) OVER (
+	                                      ORDER BY heardAtUnix, id
+	                                  ) AS seconds
+	                           FROM hearing
+	                       ), numbered AS (
+	                           SELECT id, songID, heardAt, heardAtUnix,
+	                                  SUM(seconds IS NULL OR seconds > ?1) OVER (
+	                                      ORDER BY heardAtUnix, id
+	                                  ) AS session
+	                           FROM pause
+	                       ), selected AS (
+	                           SELECT session FROM numbered
+	                           GROUP BY session
+	                           HAVING MIN(heardAtUnix) BETWEEN ?2 AND ?3
+	                           ORDER BY session `+order+`
+	                           LIMIT ?4 OFFSET ?5
+	                       )
+	                       SELECT (SELECT MAX(session) FROM numbered) - session + 1,
+	                              name, heardAt
+	                       FROM numbered
+	                       INNER JOIN selected USING (session)
+	                       INNER JOIN song ON song.id = numbered.songID
+	                       ORDER BY session `+order+`, heardAtUnix, numbered.id`,
+		int64(opts.Gap/time.Second), fromUnix, toUnix, limit, offset)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var number int
+		var name, heardAt string
+		if err = rows.Scan(&number, &name, &heardAt); err != nil {
+			return
+		}
+		var date time.Time
+		if date, err = time.Parse(time.RFC3339, heardAt); err != nil {
+			return
+		}
+		if len(sessions) == 0 || sessions[len(sessions)-1].Number != number {
+			sessions = append(sessions, Session{Number: number, Start: date})
+		}
+		s := &sessions[len(sessions)-1]
+		s.End = date
+		s.Songs = append(s.Songs, name)
+	}
+	return sessions, rows.Err()
+}
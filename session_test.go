@@ -0,0 +1,82 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListSessions(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	hearings := []struct {
+		song    string
+		minutes int
+	}{
+		{"a", 0}, {"b", 4}, {"a", 30}, // The pause of 26m is short enough.
+		{"c", 120}, {"d", 124},
+		{"e", 600},
+	}
+	for _, h := range hearings {
+		at := start.Add(time.Duration(h.minutes) * time.Minute)
+		if err := db.AddHearingAndSongIfNeededAt(h.song, at); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+
+	sessions, err := db.ListSessions(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Could not list sessions: %v", err)
+	}
+	want := []Session{
+		{3, start, start.Add(30 * time.Minute), []string{"a", "b", "a"}},
+		{2, start.Add(120 * time.Minute), start.Add(124 * time.Minute), []string{"c", "d"}},
+		{1, start.Add(600 * time.Minute), start.Add(600 * time.Minute), []string{"e"}},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("Got %d sessions, want %d", len(sessions), len(want))
+	}
+	for i := range want {
+		if sessions[i].Number != want[i].Number || !sessions[i].Start.Equal(want[i].Start) || !sessions[i].End.Equal(want[i].End) ||
+			!reflect.DeepEqual(sessions[i].Songs, want[i].Songs) {
+			t.Errorf("Got session %+v, want %+v", sessions[i], want[i])
+		}
+	}
+
+	// Sessions are not cut off by from and to.
+	sessions, err = db.ListSessionsWithGap(start.Add(-time.Minute), start.Add(10*time.Minute), 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Could not list sessions: %v", err)
+	}
+	if len(sessions) != 1 || !reflect.DeepEqual(sessions[0].Songs, []string{"a", "b", "a", "c", "d"}) {
+		t.Errorf("Got sessions %+v, want one session of a, b, a, c and d", sessions)
+	}
+	sessions, err = db.ListSessions(start.Add(time.Minute), time.Time{})
+	if err != nil {
+		t.Fatalf("Could not list sessions: %v", err)
+	}
+	if len(sessions) != 2 || !sessions[0].Start.Equal(want[1].Start) {
+		t.Errorf("Got sessions %+v, want the sessions starting with c and e", sessions)
+	}
+
+	// Offset and limit count from the latest session with NewestFirst.
+	sessions, err = db.ListSessionsWithOptions(SessionOptions{
+		Gap:         DefaultSessionGap,
+		NewestFirst: true,
+		Offset:      1,
+		Limit:       1,
+	})
+	if err != nil {
+		t.Fatalf("Could not list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Number != 2 ||
+		!reflect.DeepEqual(sessions[0].Songs, []string{"c", "d"}) {
+		t.Errorf("Got sessions %+v, want only session 2 of c and d", sessions)
+	}
+	_, err = db.ListSessionsWithOptions(SessionOptions{Gap: DefaultSessionGap, Limit: -1})
+	if err == nil {
+		t.Errorf("Listing sessions with a negative limit did not fail")
+	}
+}
@@ -0,0 +1,197 @@
+package songmem
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Song is a song from the database. Artist, Title and Album are empty,
+// if they are unknown.
+type Song struct {
+	ID      int64
+	Name    string
+	Artist  string
+	Title   string
+	Album   string
+	AddedAt time.Time
+}
+
+// SplitSongName splits a song name like "<artist><sep><title>" at the
+// first occurrence of sep. If name does not contain sep, the artist is
+// empty and the title is the whole name.
+func SplitSongName(name, sep string) (artist, title string) {
+	if sep != "" {
+		if i := strings.Index(name, sep); i >= 0 {
+			return strings.TrimSpace(name[:i]), strings.TrimSpace(name[i+len(sep):])
+		}
+	}
+	return "", strings.TrimSpace(name)
+}
+
+func (db SongDB) songFromName(name string) Song {
+	artist, title := SplitSongName(name, db.Separator)
+	return Song{Name: name, Artist: artist, Title: title}
+}
+
+// addSongMetadataColumns adds the artist, title and album columns to
+// the song table and fills them by splitting the songs' names.
+//
+// Databases, that were created before the schema was versioned, may
+// already contain these columns.
+func addSongMetadataColumns(db SongDB, tx *sql.Tx) (err error) {
+	rows, err := tx.Query(`PRAGMA table_info(song)`)
+	if err != nil {
+		return
+	}
+	hasArtist := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return
+		}
+		hasArtist = hasArtist || name == "artist"
+	}
+	if err = rows.Close(); err != nil || hasArtist {
+		return
+	}
+	for _, column := range [...]string{"artist", "title", "album"} {
+		if _, err = tx.Exec(`ALTER TABLE song ADD COLUMN ` + column + ` TEXT`); err != nil {
+			return
+		}
+	}
+	if _, err = tx.Exec(`CREATE INDEX IF NOT EXISTS song_artist
+	                     ON song(artist COLLATE NOCASE)`); err != nil {
+		return
+	}
+	return splitSongNames(tx, db.Separator)
+}
+
+// SplitSongNames sets the artist and title of all songs by splitting
+// their names at the database's separator. Previously set artists and
+// titles are overwritten. Albums are not changed.
+func (db SongDB) SplitSongNames() (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if err = splitSongNames(tx, db.Separator); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+func splitSongNames(e execQueryer, sep string) (err error) {
+	rows, err := e.Query(`SELECT id, name FROM song`)
+	if err != nil {
+		return
+	}
+	var songs []Song
+	for rows.Next() {
+		var s Song
+		if err = rows.Scan(&s.ID, &s.Name); err != nil {
+			rows.Close()
+			return
+		}
+		s.Artist, s.Title = SplitSongName(s.Name, sep)
+		songs = append(songs, s)
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+	for _, s := range songs {
+		_, err = e.Exec(`UPDATE song SET artist = ?, title = ? WHERE id = ?`,
+			nullString(s.Artist), nullString(s.Title), s.ID)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ListSongsByArtist lists all songs of the given artist. The songs you
+// heard most often are listed first.
+func (db SongDB) ListSongsByArtist(artist string) (songs []Song, err error) {
+	return db.ListSongsByArtistWithOptions(artist, QueryOptions{})
+}
+
+// ListSongsByArtistWithOptions lists the songs of the given artist. The
+// songs you heard most often between opts.Since and opts.Until are
+// listed first. opts.Omit is ignored.
+func (db SongDB) ListSongsByArtistWithOptions(artist string, opts QueryOptions) (songs []Song, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	since, until := opts.bounds()
+	limit, offset := opts.sqlLimit()
+	rows, err := db.Query(`SELECT song.id, name, artist, title, album, addedAt
+	                       FROM song
+	                       LEFT JOIN hearing ON song.id = hearing.songID
+	                           AND heardAtUnix BETWEEN ? AND ?
+	                       WHERE artist = ? COLLATE NOCASE
+	                       GROUP BY song.id
+	                       ORDER BY COUNT(hearing.id) DESC, name
+	                       LIMIT ? OFFSET ?`, since, until, artist, limit, offset)
+	if err != nil {
+		return
+	}
+	return extractSongStructs(rows)
+}
+
+// ListFavouriteArtists lists all known artists, listing those first,
+// that you heard most often.
+func (db SongDB) ListFavouriteArtists() (artists []string, err error) {
+	return db.ListFavouriteArtistsWithOptions(QueryOptions{})
+}
+
+// ListFavouriteArtistsWithOptions lists the artists, that you heard
+// between opts.Since and opts.Until, listing those first, that you
+// heard most often. opts.Omit is ignored.
+func (db SongDB) ListFavouriteArtistsWithOptions(opts QueryOptions) (artists []string, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	since, until := opts.bounds()
+	limit, offset := opts.sqlLimit()
+	rows, err := db.Query(`SELECT artist FROM hearing
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       WHERE artist IS NOT NULL
+	                       AND heardAtUnix BETWEEN ? AND ?
+	                       GROUP BY artist COLLATE NOCASE
+	                       ORDER BY COUNT(*) DESC, artist COLLATE NOCASE
+	                       LIMIT ? OFFSET ?`, since, until, limit, offset)
+	if err != nil {
+		return
+	}
+	return extractSongs(rows)
+}
+
+// extractSongStructs scans rows of id, name, artist, title, album and
+// addedAt.
+func extractSongStructs(rows *sql.Rows) (songs []Song, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		var s Song
+		var artist, title, album sql.NullString
+		var addedAt string
+		err = rows.Scan(&s.ID, &s.Name, &artist, &title, &album, &addedAt)
+		if err != nil {
+			return
+		}
+		if s.AddedAt, err = time.Parse(time.RFC3339, addedAt); err != nil {
+			return
+		}
+		s.Artist, s.Title, s.Album = artist.String, title.String, album.String
+		songs = append(songs, s)
+	}
+	return songs, rows.Err()
+}
+
+// nullString converts empty strings to NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
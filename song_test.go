@@ -0,0 +1,94 @@
+package songmem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSongMetadataMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "songmem")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := InitDB(filepath.Join(dir, "songmem.sql"))
+	if err != nil {
+		t.Fatalf("Could not initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// The schema before artists and titles were stored.
+	commands := []string{
+		`CREATE TABLE song(
+		     id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		     name    TEXT NOT NULL,
+		     addedAt TEXT NOT NULL,
+		     CONSTRAINT name_unique UNIQUE(name COLLATE NOCASE)
+		 )`,
+		`CREATE TABLE hearing(
+		     id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		     songID  INTEGER NOT NULL,
+		     heardAt TEXT NOT NULL,
+		     FOREIGN KEY(songID) REFERENCES song(id)
+		 )`,
+		`INSERT INTO song(name, addedAt) VALUES
+		     ('Foo / Bar', '2020-05-17T21:30:00+02:00'),
+		     ('Foo / Baz', '2020-05-17T21:35:00+02:00'),
+		     ('Qux / Quux', '2020-05-17T21:40:00+02:00'),
+		     ('Untitled', '2020-05-17T21:45:00+02:00')`,
+		`INSERT INTO hearing(songID, heardAt) VALUES
+		     (2, '2020-05-17T21:35:00+02:00'),
+		     (3, '2020-05-17T21:40:00+02:00'),
+		     (3, '2020-05-17T21:45:00+02:00')`,
+	}
+	for _, c := range commands {
+		if _, err = db.Exec(c); err != nil {
+			t.Fatalf("Could not create old schema: %v", err)
+		}
+	}
+
+	db.Separator = " / "
+	if err = db.CreateSchemaIfNotExists(); err != nil {
+		t.Fatalf("Could not migrate schema: %v", err)
+	}
+	if err = db.AddHearingAndSongIfNeeded("Foo / New"); err != nil {
+		t.Fatalf("Could not add song: %v", err)
+	}
+
+	artists, err := db.ListFavouriteArtists()
+	if err != nil {
+		t.Fatalf("Could not list artists: %v", err)
+	}
+	if want := []string{"Foo", "Qux"}; !reflect.DeepEqual(artists, want) {
+		t.Errorf("Got favourite artists %q, want %q", artists, want)
+	}
+	songs, err := db.ListSongsByArtist("foo")
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	var titles []string
+	for _, s := range songs {
+		titles = append(titles, s.Title)
+	}
+	if want := []string{"Baz", "New", "Bar"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("Got titles %q, want %q", titles, want)
+	}
+
+	artists, err = db.ListFavouriteArtistsWithOptions(QueryOptions{Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Could not list artists: %v", err)
+	}
+	if want := []string{"Qux"}; !reflect.DeepEqual(artists, want) {
+		t.Errorf("Got favourite artists %q with offset and limit, want %q", artists, want)
+	}
+	songs, err = db.ListSongsByArtistWithOptions("foo", QueryOptions{Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if len(songs) != 1 || songs[0].Title != "New" {
+		t.Errorf("Got songs %+v with offset and limit, want only New", songs)
+	}
+}
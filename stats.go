@@ -0,0 +1,180 @@
+package songmem
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// StatsTopCount is the number of songs and artists in the top lists of
+// Stats.
+const StatsTopCount = 10
+
+// Stats are statistics about the hearings within a period. Weekdays,
+// hours and days are those of the timezone, in which each hearing was
+// registered.
+type Stats struct {
+	Hearings      int `json:"hearings"`
+	DistinctSongs int `json:"distinctSongs"`
+	NewSongs      int `json:"newSongs"`
+
+	// TopSongs and TopArtists are the most heard songs and artists, most
+	// heard first.
+	TopSongs   []Count `json:"topSongs"`
+	TopArtists []Count `json:"topArtists"`
+
+	// HearingsPerWeekday is indexed by time.Weekday, starting on Sunday.
+	HearingsPerWeekday [7]int  `json:"hearingsPerWeekday"`
+	HearingsPerHour    [24]int `json:"hearingsPerHour"`
+
+	// LongestStreak is the longest series of consecutive days with
+	// hearings. If there were multiple, it is the first.
+	LongestStreak Streak `json:"longestStreak"`
+
+	// BusiestDay is the day with the most hearings. If there were
+	// multiple, it is the first. Its Name is the date, like 2006-01-02.
+	BusiestDay Count `json:"busiestDay"`
+}
+
+// Count is the number of hearings of something, like a song or an
+// artist.
+type Count struct {
+	Name     string `json:"name"`
+	Hearings int    `json:"hearings"`
+}
+
+// Streak is a series of consecutive days with hearings. Start and End
+// are dates like 2006-01-02.
+type Streak struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	Days  int    `json:"days"`
+}
+
+// Stats calculates statistics about the hearings between from and to. A
+// zero from or to means, that there is no limit.
+func (db SongDB) Stats(from, to time.Time) (stats Stats, err error) {
+	fromUnix, toUnix := unixBounds(from, to)
+	err = db.QueryRow(`SELECT COUNT(*) FROM song WHERE addedAtUnix BETWEEN ? AND ?`,
+		fromUnix, toUnix).Scan(&stats.NewSongs)
+	if err != nil {
+		return
+	}
+	rows, err := db.Query(`SELECT name, artist, heardAt FROM hearing
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       WHERE heardAtUnix BETWEEN ? AND ?
+	                       ORDER BY heardAtUnix, hearing.id`, fromUnix, toUnix)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	songs := make(map[string]int)
+	artists := make(map[string]int)
+	var days []Count
+	for rows.Next() {
+		var name, heardAt string
+		var artist sql.NullString
+		if err = rows.Scan(&name, &artist, &heardAt); err != nil {
+			return
+		}
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, heardAt); err != nil {
+			return
+		}
+		stats.Hearings++
+		songs[name]++
+		if artist.Valid {
+			artists[artist.String]++
+		}
+		stats.HearingsPerWeekday[t.Weekday()]++
+		stats.HearingsPerHour[t.Hour()]++
+		day := t.Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Name != day {
+			days = append(days, Count{Name: day})
+		}
+		days[len(days)-1].Hearings++
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	stats.DistinctSongs = len(songs)
+	stats.TopSongs = topCounts(songs, StatsTopCount)
+	stats.TopArtists = topCounts(artists, StatsTopCount)
+	days = mergeDays(days)
+	for _, d := range days {
+		if d.Hearings > stats.BusiestDay.Hearings {
+			stats.BusiestDay = d
+		}
+	}
+	stats.LongestStreak = longestStreak(days)
+	return
+}
+
+// unixBounds converts from and to into unix time. A zero from or to is
+// converted into the smallest or largest possible time.
+func unixBounds(from, to time.Time) (fromUnix, toUnix int64) {
+	fromUnix, toUnix = math.MinInt64, math.MaxInt64
+	if !from.IsZero() {
+		fromUnix = from.Unix()
+	}
+	if !to.IsZero() {
+		toUnix = to.Unix()
+	}
+	return
+}
+
+// topCounts returns the n largest counts, ordered by their number of
+// hearings and then by name.
+func topCounts(counts map[string]int, n int) []Count {
+	top := make([]Count, 0, len(counts))
+	for name, hearings := range counts {
+		top = append(top, Count{name, hearings})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Hearings != top[j].Hearings {
+			return top[i].Hearings > top[j].Hearings
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// mergeDays sorts days by date and merges duplicates. Hearings in
+// different timezones can be out of order by their local date.
+func mergeDays(days []Count) []Count {
+	sort.SliceStable(days, func(i, j int) bool { return days[i].Name < days[j].Name })
+	var merged []Count
+	for _, d := range days {
+		if len(merged) > 0 && merged[len(merged)-1].Name == d.Name {
+			merged[len(merged)-1].Hearings += d.Hearings
+		} else {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+// longestStreak finds the longest series of consecutive days in days,
+// which must be sorted.
+func longestStreak(days []Count) (longest Streak) {
+	var current Streak
+	var prev time.Time
+	for _, d := range days {
+		date, _ := time.Parse("2006-01-02", d.Name)
+		if current.Days > 0 && date.Sub(prev) == 24*time.Hour {
+			current.End = d.Name
+			current.Days++
+		} else {
+			current = Streak{Start: d.Name, End: d.Name, Days: 1}
+		}
+		if current.Days > longest.Days {
+			longest = current
+		}
+		prev = date
+	}
+	return
+}
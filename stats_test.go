@@ -0,0 +1,56 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Sunday, 2020-05-17.
+	day := time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	hearings := []songHearing{
+		{"X - a", day.AddDate(0, 0, -10)}, // Before the period.
+		{"X - a", day.Add(9 * time.Hour)},
+		{"X - b", day.Add(10 * time.Hour)},
+		{"Y - c", day.Add(10 * time.Hour)},
+		{"X - a", day.AddDate(0, 0, 1).Add(9 * time.Hour)},
+		// 2020-05-19 in Tokyo, although it is still 2020-05-18 in UTC.
+		{"X - a", day.AddDate(0, 0, 1).Add(20 * time.Hour).In(tokyo)},
+		{"Y - c", day.AddDate(0, 0, 5).Add(9 * time.Hour)},
+	}
+	addHearings(t, db, hearings)
+
+	stats, err := db.Stats(day, time.Time{})
+	if err != nil {
+		t.Fatalf("Could not calculate stats: %v", err)
+	}
+	if stats.Hearings != 6 || stats.DistinctSongs != 3 || stats.NewSongs != 2 {
+		t.Errorf("Got %d hearings of %d songs and %d new songs, want 6, 3 and 2",
+			stats.Hearings, stats.DistinctSongs, stats.NewSongs)
+	}
+	wantSongs := []Count{{"X - a", 3}, {"Y - c", 2}, {"X - b", 1}}
+	if !reflect.DeepEqual(stats.TopSongs, wantSongs) {
+		t.Errorf("Got top songs %v, want %v", stats.TopSongs, wantSongs)
+	}
+	wantArtists := []Count{{"X", 4}, {"Y", 2}}
+	if !reflect.DeepEqual(stats.TopArtists, wantArtists) {
+		t.Errorf("Got top artists %v, want %v", stats.TopArtists, wantArtists)
+	}
+	if stats.HearingsPerWeekday[time.Sunday] != 3 || stats.HearingsPerWeekday[time.Tuesday] != 1 {
+		t.Errorf("Got hearings per weekday %v", stats.HearingsPerWeekday)
+	}
+	if stats.HearingsPerHour[9] != 3 || stats.HearingsPerHour[5] != 1 {
+		t.Errorf("Got hearings per hour %v", stats.HearingsPerHour)
+	}
+	if want := (Streak{"2020-05-17", "2020-05-19", 3}); stats.LongestStreak != want {
+		t.Errorf("Got longest streak %v, want %v", stats.LongestStreak, want)
+	}
+	if want := (Count{"2020-05-17", 3}); stats.BusiestDay != want {
+		t.Errorf("Got busiest day %v, want %v", stats.BusiestDay, want)
+	}
+}
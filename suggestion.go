@@ -1,42 +1,341 @@
 package songmem
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"time"
 )
 
+// suggestionWindowHalfLives is the number of suggestion half-lives,
+// after which hearings are no longer considered to be correlated. At
+// this distance, a hearing would contribute less than 2^-16 to the
+// correlation.
+const suggestionWindowHalfLives = 16
+
 // songHearingsToSuggestions transforms []songHearing to a slice of
-// songs. The songs will be ordered by their correlation to the given
-// song.
+// scored songs. The songs will be ordered by their correlation to the
+// given song, which is also their score. shs must be ordered by time.
 //
 // The algorithm for determining the correlation calculates the sum of
-// e ^ (-λ_1h * abs(time_of_hearing - closest_hearing_of_given_song))
-// for every song.
-func songHearingsToSuggestions(shs []songHearing, song string) ([]string, error) {
-	var gshts []time.Time // given song hearing times
-	for _, sh := range shs {
+// e ^ (-λ * abs(time_of_hearing - closest_hearing_of_given_song))
+// for every song, where λ = ln(2) / halfLife. The closest hearing of
+// the given song in the direction of opts.Direction is found with a
+// binary search, so that the runtime is O(n log m) for n hearings and
+// m hearings of the given song.
+func songHearingsToSuggestions(shs []songHearing, song string, opts SuggestionOptions) ([]ScoredSong, error) {
+	correlations, err := songHearingsToCorrelations(shs, song, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return rankSongs(correlations, shs, opts.Offset, opts.Limit), nil
+}
+
+// songHearingsToCorrelations calculates the correlation of every song
+// in shs, except song itself, to song. shs must be ordered by time.
+//
+// Only the closest hearing of song in opts.Direction is considered for
+// each hearing. If opts.SessionGap is set, it must also be in the same
+// session. Hearings, that are further away from song's hearings than
+// the suggestion window, are ignored.
+//
+// The hearings of omitted songs only separate sessions; no correlation
+// is calculated for them.
+func songHearingsToCorrelations(shs []songHearing, song string, omitted map[string]bool,
+	opts SuggestionOptions) (map[string]float64, error) {
+	type seedHearing struct {
+		date    time.Time
+		session int
+	}
+	var seeds []seedHearing
+	sessions := make([]int, len(shs))
+	for i, sh := range shs {
+		if i > 0 {
+			sessions[i] = sessions[i-1]
+			if opts.SessionGap > 0 && sh.Date.Sub(shs[i-1].Date) > opts.SessionGap {
+				sessions[i]++
+			}
+		}
 		if sh.Name == song {
-			gshts = append(gshts, sh.Date)
+			seeds = append(seeds, seedHearing{sh.Date, sessions[i]})
 		}
 	}
-	if len(gshts) == 0 {
+	if len(seeds) == 0 {
 		return nil, errors.New("the given song was never heard")
 	}
 
-	const lambda float64 = 0.01155245301 // ln(2) / 60min
+	halfLife := opts.suggestionHalfLife()
+	window := suggestionWindowHalfLives * halfLife
+	lambda := math.Ln2 / halfLife.Minutes()
 	correlations := make(map[string]float64)
-	for _, sh := range shs {
-		if sh.Name == song {
+	for i, sh := range shs {
+		if sh.Name == song || omitted[sh.Name] {
 			continue
 		}
-		var minTimespan = math.MaxFloat64
-		for _, gsht := range gshts {
-			timespan := math.Abs(gsht.Sub(sh.Date).Minutes())
-			minTimespan = math.Min(timespan, minTimespan)
+		minTimespan := window + 1
+		consider := func(seed seedHearing, timespan time.Duration) {
+			if seed.session == sessions[i] && timespan < minTimespan {
+				minTimespan = timespan
+			}
+		}
+		if opts.Direction != DirectionAfter {
+			// The first hearing of song, that is not before sh.
+			j := sort.Search(len(seeds), func(j int) bool { return !seeds[j].date.Before(sh.Date) })
+			if j < len(seeds) {
+				consider(seeds[j], seeds[j].date.Sub(sh.Date))
+			}
+		}
+		if opts.Direction != DirectionBefore {
+			// The last hearing of song, that is not after sh.
+			j := sort.Search(len(seeds), func(j int) bool { return seeds[j].date.After(sh.Date) }) - 1
+			if j >= 0 {
+				consider(seeds[j], sh.Date.Sub(seeds[j].date))
+			}
+		}
+		if minTimespan <= window {
+			correlations[sh.Name] += math.Exp(-lambda * minTimespan.Minutes())
 		}
-		correlations[sh.Name] += math.Exp(-lambda * minTimespan)
 	}
+	return correlations, nil
+}
 
-	return songRatingsToSongs(correlations), nil
+// ListSuggestionsForSeeds lists songs that you often hear before or
+// after hearing the given seeds. The seeds themselves are not listed.
+// Best suggestions first.
+func (db SongDB) ListSuggestionsForSeeds(seeds []string, opts SuggestionOptions) (songs []string, err error) {
+	scoredSongs, err := db.RankSuggestionsForSeeds(seeds, opts)
+	return scoredSongsToNames(scoredSongs), err
+}
+
+// RankSuggestionsForSeeds ranks songs by how often you hear them before
+// or after hearing the given seeds. The correlations to the individual
+// seeds are weighted and combined as configured by opts; the result is
+// the score. The seeds themselves are not ranked. Like the
+// suggestions, HearingCount and LastHeard only cover the hearings
+// between opts.Since and opts.Until.
+func (db SongDB) RankSuggestionsForSeeds(seeds []string, opts SuggestionOptions) (songs []ScoredSong, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	if len(seeds) == 0 {
+		return nil, errors.New("no seeds given")
+	}
+	if opts.Weights != nil && len(opts.Weights) != len(seeds) {
+		return nil, fmt.Errorf("got %d weights for %d seeds", len(opts.Weights), len(seeds))
+	}
+	window := suggestionWindowHalfLives * opts.suggestionHalfLife()
+	perSeed := make([]map[string]float64, len(seeds))
+	for i, seed := range seeds {
+		if _, err = songID(db, seed); err != nil {
+			if len(seeds) > 1 {
+				err = fmt.Errorf("%w: '%s'", err, seed)
+			}
+			return nil, err
+		}
+		shs, omitted, err := db.querySuggestionHearings(seed, window, opts.QueryOptions)
+		if err != nil {
+			return nil, err
+		}
+		if perSeed[i], err = songHearingsToCorrelations(shs, seed, omitted, opts); err != nil {
+			if len(seeds) > 1 {
+				err = fmt.Errorf("%v: '%s'", err, seed)
+			}
+			return nil, err
+		}
+	}
+	scores := aggregateCorrelations(perSeed, opts)
+	for _, seed := range seeds {
+		delete(scores, seed)
+	}
+	songs = rankSongs(scores, nil, opts.Offset, opts.Limit)
+	since, until := opts.bounds()
+	return songs, db.setHearingStats(songs, since, until)
+}
+
+// aggregateCorrelations combines the correlations of songs to multiple
+// seeds into one score per song.
+func aggregateCorrelations(perSeed []map[string]float64, opts SuggestionOptions) map[string]float64 {
+	weight := func(i int) float64 {
+		if opts.Weights == nil {
+			return 1
+		}
+		return opts.Weights[i]
+	}
+	scores := make(map[string]float64)
+	switch opts.Aggregation {
+	case AggregateMax:
+		for i, correlations := range perSeed {
+			for song, c := range correlations {
+				scores[song] = math.Max(scores[song], weight(i)*c)
+			}
+		}
+	case AggregateGeometricMean:
+		// Songs, that are not correlated to every seed, have a geometric
+		// mean of 0 and are left out.
+		var weightSum float64
+		for i := range perSeed {
+			weightSum += weight(i)
+		}
+		for song := range perSeed[0] {
+			var logSum float64
+			for i, correlations := range perSeed {
+				c, ok := correlations[song]
+				if !ok || c == 0 {
+					logSum = math.Inf(-1)
+					break
+				}
+				logSum += weight(i) * math.Log(c)
+			}
+			if !math.IsInf(logSum, -1) {
+				scores[song] = math.Exp(logSum / weightSum)
+			}
+		}
+	default:
+		for i, correlations := range perSeed {
+			for song, c := range correlations {
+				scores[song] += weight(i) * c
+			}
+		}
+	}
+	return scores
+}
+
+// querySuggestionHearings returns the hearings between opts.Since and
+// opts.Until, that happened at most window before or after a hearing of
+// song in this period, ordered by time. Songs, that were heard within
+// the omit timespan before now, are returned as omitted, except for
+// song itself. Their hearings are still returned, so that they do not
+// leave gaps, that would look like the end of a session.
+//
+// The windows around the hearings of song are merged, where they
+// overlap, so that no hearing is returned twice. They are clamped to the
+// period, instead of filtering the joined hearings, so that SQLite looks
+// up the hearings of each window, instead of scanning all hearings.
+func (db SongDB) querySuggestionHearings(song string, window time.Duration,
+	opts QueryOptions) (shs []songHearing, omitted map[string]bool, err error) {
+	since, until := opts.bounds()
+	rows, err := db.Query(`WITH seed AS (
+	                           SELECT heardAtUnix - ?1 AS startUnix,
+	                                  heardAtUnix + ?1 AS endUnix,
+	                                  MAX(heardAtUnix + ?1) OVER (
+	                                      ORDER BY heardAtUnix
+	                                      ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+	                                  ) AS prevEndUnix
+	                           FROM hearing
+	                           WHERE songID = (SELECT id FROM song WHERE name = ?2)
+	                           AND heardAtUnix BETWEEN ?4 AND ?5
+	                       ), island AS (
+	                           SELECT startUnix, endUnix,
+	                                  SUM(prevEndUnix IS NULL OR prevEndUnix < startUnix)
+	                                      OVER (ORDER BY startUnix) AS n
+	                           FROM seed
+	                       ), span AS (
+	                           SELECT MAX(MIN(startUnix), ?4) AS startUnix,
+	                                  MIN(MAX(endUnix), ?5) AS endUnix
+	                           FROM island GROUP BY n
+	                       )
+	                       SELECT name, heardAt, name != ?2 AND hearing.songID IN (
+	                           SELECT songID FROM hearing WHERE heardAtUnix > ?3
+	                       ) FROM span
+	                       INNER JOIN hearing
+	                           ON hearing.heardAtUnix BETWEEN span.startUnix AND span.endUnix
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       ORDER BY hearing.heardAtUnix`,
+		int64(window/time.Second), song, omitDeadline(opts.Omit), since, until)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	omitted = make(map[string]bool)
+	for rows.Next() {
+		var sh songHearing
+		var heardAt string
+		var isOmitted bool
+		if err = rows.Scan(&sh.Name, &heardAt, &isOmitted); err != nil {
+			return
+		}
+		if sh.Date, err = time.Parse(time.RFC3339, heardAt); err != nil {
+			return
+		}
+		shs = append(shs, sh)
+		if isOmitted {
+			omitted[sh.Name] = true
+		}
+	}
+	return shs, omitted, rows.Err()
+}
+
+// setHearingStats sets HearingCount and LastHeard of songs from their
+// hearings between since and until.
+func (db SongDB) setHearingStats(songs []ScoredSong, since, until int64) (err error) {
+	const chunkSize = 500 // SQLite allows at most 999 parameters.
+	indices := make(map[string]int, len(songs))
+	for i, s := range songs {
+		indices[s.Name] = i
+	}
+	for start := 0; start < len(songs); start += chunkSize {
+		end := start + chunkSize
+		if end > len(songs) {
+			end = len(songs)
+		}
+		args := []interface{}{since, until}
+		for _, s := range songs[start:end] {
+			args = append(args, s.Name)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", end-start), ",")
+		var rows *sql.Rows
+		// Counting from the index on songID and heardAtUnix alone and
+		// reading only the last hearing from the table is a lot faster
+		// for songs with many hearings. The plain placeholders of the
+		// names are numbered after ?1 and ?2.
+		rows, err = db.Query(`SELECT name, COUNT(*), (
+		                          SELECT heardAt FROM hearing AS last
+		                          WHERE last.songID = song.id
+		                            AND last.heardAtUnix BETWEEN ?1 AND ?2
+		                          ORDER BY heardAtUnix DESC LIMIT 1
+		                      )
+		                      FROM song
+		                      INNER JOIN hearing ON song.id = hearing.songID
+		                      WHERE name IN (`+placeholders+`)
+		                        AND hearing.heardAtUnix BETWEEN ?1 AND ?2
+		                      GROUP BY song.id`, args...)
+		if err != nil {
+			return
+		}
+		for rows.Next() {
+			var name, heardAt string
+			var count int
+			if err = rows.Scan(&name, &count, &heardAt); err != nil {
+				rows.Close()
+				return
+			}
+			s := &songs[indices[name]]
+			s.HearingCount = count
+			if s.LastHeard, err = time.Parse(time.RFC3339, heardAt); err != nil {
+				rows.Close()
+				return
+			}
+		}
+		if err = rows.Close(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// addSongTimeIndex adds an index for looking up the hearings of a song
+// in order of time. It replaces the index on songID alone.
+func addSongTimeIndex(db SongDB, tx *sql.Tx) (err error) {
+	commands := [...]string{
+		`CREATE INDEX hearing_songID_heardAtUnix ON hearing(songID, heardAtUnix)`,
+		`DROP INDEX IF EXISTS hearing_songID`}
+	for _, c := range commands {
+		if _, err = tx.Exec(c); err != nil {
+			return
+		}
+	}
+	return
 }
@@ -15,7 +15,7 @@ func BenchmarkSongHearingsToSuggestions(b *testing.B) {
 				ref := songHearings[0].Name
 				b.ResetTimer()
 				for i := 0; i < b.N; i++ {
-					_, err := songHearingsToSuggestions(songHearings, ref)
+					_, err := songHearingsToSuggestions(songHearings, ref, SuggestionOptions{})
 					if err != nil {
 						b.Fatalf("Could not transform song hearings to suggestions: %v", err)
 					}
@@ -24,6 +24,36 @@ func BenchmarkSongHearingsToSuggestions(b *testing.B) {
 	}
 }
 
+// BenchmarkRankSuggestions ranks the suggestions for a rarely heard
+// seed and for a seed, that was heard hundreds of times. At 1M
+// hearings, ranking must take less than a second.
+func BenchmarkRankSuggestions(b *testing.B) {
+	for hearingsCnt := 1_000; hearingsCnt <= 1_000_000; hearingsCnt *= 10 {
+		songCnt := hearingsCnt / 4
+		b.Run(fmt.Sprintf("%d hearings of %d songs", hearingsCnt, songCnt),
+			func(b *testing.B) {
+				db, cleanup := newTestDB(b)
+				defer cleanup()
+				songHearings := generateRecurringSongHearings(hearingsCnt, songCnt)
+				insertSongHearings(b, db, songHearings)
+				for _, seed := range []string{songHearings[0].Name, frequentSeed} {
+					b.Run("seed "+seed, func(b *testing.B) {
+						start := time.Now()
+						for i := 0; i < b.N; i++ {
+							if _, err := db.RankSuggestions(seed, QueryOptions{}); err != nil {
+								b.Fatalf("Could not rank suggestions: %v", err)
+							}
+						}
+						perOp := time.Since(start) / time.Duration(b.N)
+						if hearingsCnt >= 1_000_000 && perOp >= time.Second {
+							b.Errorf("Ranking took %v, want less than a second", perOp)
+						}
+					})
+				}
+			})
+	}
+}
+
 func generateSongHearings(hearingsCnt, songCnt int) []songHearing {
 	song := 0
 	t := time.Now()
@@ -37,3 +67,64 @@ func generateSongHearings(hearingsCnt, songCnt int) []songHearing {
 	}
 	return shs
 }
+
+// generateRecurringSongHearings generates frequentSeedHearings hearings
+// of frequentSeed, spread evenly across all hearings.
+const (
+	frequentSeed         = "frequent"
+	frequentSeedHearings = 200
+)
+
+// generateRecurringSongHearings generates hearings of songCnt songs,
+// which are heard in turn, every three minutes, up until now. Some of
+// the hearings are of frequentSeed instead.
+func generateRecurringSongHearings(hearingsCnt, songCnt int) []songHearing {
+	song := 0
+	t := time.Now().Add(-time.Duration(hearingsCnt) * 3 * time.Minute)
+	seedInterval := hearingsCnt / frequentSeedHearings
+	shs := make([]songHearing, hearingsCnt)
+	for i := 0; i < hearingsCnt; i++ {
+		song = (song + 1) % songCnt
+		shs[i] = songHearing{
+			Name: fmt.Sprint("song", song),
+			Date: t.Add(time.Duration(i) * 3 * time.Minute),
+		}
+		if i%seedInterval == seedInterval-1 {
+			shs[i].Name = frequentSeed
+		}
+	}
+	return shs
+}
+
+// insertSongHearings inserts shs into db in a single transaction, which
+// is a lot faster than using AddHearingAndSongIfNeededAt.
+func insertSongHearings(b *testing.B, db SongDB, shs []songHearing) {
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatalf("Could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	songIDs := make(map[string]int64)
+	for _, sh := range shs {
+		id, ok := songIDs[sh.Name]
+		if !ok {
+			s := Song{Name: sh.Name, Title: sh.Name}
+			if err = addSongAt(tx, s, sh.Date); err != nil {
+				b.Fatalf("Could not add song: %v", err)
+			}
+			if err = tx.QueryRow(`SELECT last_insert_rowid()`).Scan(&id); err != nil {
+				b.Fatalf("Could not get song ID: %v", err)
+			}
+			songIDs[sh.Name] = id
+		}
+		_, err = tx.Exec(`INSERT INTO hearing(songID, heardAt, heardAtUnix)
+		                  VALUES (?, ?, ?)`,
+			id, sh.Date.Format(time.RFC3339), sh.Date.Unix())
+		if err != nil {
+			b.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		b.Fatalf("Could not commit: %v", err)
+	}
+}
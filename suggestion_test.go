@@ -0,0 +1,170 @@
+package songmem
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankSuggestionsForSeeds(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// "both" is heard around both seeds, "onlyA" only around a. The seeds
+	// are heard more than 16 half-lives apart.
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	hearings := []struct {
+		song    string
+		minutes int
+	}{
+		{"a", 0}, {"both", 60}, {"onlyA", 30},
+		{"b", 1200}, {"both", 1260},
+	}
+	for _, h := range hearings {
+		at := start.Add(time.Duration(h.minutes) * time.Minute)
+		if err := db.AddHearingAndSongIfNeededAt(h.song, at); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+
+	tests := []struct {
+		opts   SuggestionOptions
+		want   []string
+		scores []float64
+	}{
+		{SuggestionOptions{}, []string{"both", "onlyA"},
+			[]float64{0.5 + 0.5, math.Pow(2, -0.5)}},
+		{SuggestionOptions{Aggregation: AggregateMax}, []string{"onlyA", "both"},
+			[]float64{math.Pow(2, -0.5), 0.5}},
+		{SuggestionOptions{Aggregation: AggregateGeometricMean}, []string{"both"},
+			[]float64{0.5}},
+		{SuggestionOptions{Weights: []float64{1, 3}}, []string{"both", "onlyA"},
+			[]float64{0.5 + 3*0.5, math.Pow(2, -0.5)}},
+	}
+	for _, test := range tests {
+		songs, err := db.RankSuggestionsForSeeds([]string{"a", "b"}, test.opts)
+		if err != nil {
+			t.Fatalf("Could not rank suggestions with %+v: %v", test.opts, err)
+		}
+		var names []string
+		var scores []float64
+		for _, s := range songs {
+			names = append(names, s.Name)
+			scores = append(scores, s.Score)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("Got suggestions %q with %+v, want %q", names, test.opts, test.want)
+			continue
+		}
+		for i := range scores {
+			if math.Abs(scores[i]-test.scores[i]) > 1e-9 {
+				t.Errorf("Got score %v for %s with %+v, want %v",
+					scores[i], names[i], test.opts, test.scores[i])
+			}
+		}
+	}
+
+	invalid := []SuggestionOptions{
+		{Aggregation: "median"},
+		{Weights: []float64{1}},
+		{Weights: []float64{1, -1}},
+	}
+	for _, opts := range invalid {
+		if _, err := db.RankSuggestionsForSeeds([]string{"a", "b"}, opts); err == nil {
+			t.Errorf("Ranking suggestions with %+v did not fail", opts)
+		}
+	}
+}
+
+func TestSuggestionHearingStatsSinceUntil(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	summer := time.Date(2020, time.July, 1, 12, 0, 0, 0, time.UTC)
+	hearings := []songHearing{
+		{"b", summer.AddDate(0, -1, 0)},
+		{"a", summer},
+		{"b", summer.Add(3 * time.Minute)},
+		{"a", summer.AddDate(0, 0, 1)},
+		{"b", summer.AddDate(0, 0, 1).Add(3 * time.Minute)},
+		{"b", summer.AddDate(0, 1, 0)},
+	}
+	addHearings(t, db, hearings)
+
+	opts := SuggestionOptions{QueryOptions: QueryOptions{
+		Since: summer.Add(-time.Hour),
+		Until: summer.AddDate(0, 0, 2),
+	}}
+	songs, err := db.RankSuggestionsForSeeds([]string{"a"}, opts)
+	if err != nil {
+		t.Fatalf("Could not rank suggestions: %v", err)
+	}
+	lastHeard := summer.AddDate(0, 0, 1).Add(3 * time.Minute)
+	if len(songs) != 1 || songs[0].HearingCount != 2 || !songs[0].LastHeard.Equal(lastHeard) {
+		t.Errorf("Got suggestions %+v, want b heard twice, last at %v", songs, lastHeard)
+	}
+}
+
+func TestSuggestionDirection(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	hearings := []struct {
+		song    string
+		minutes int
+	}{
+		{"before", 0}, {"seed", 5}, {"after", 10}, {"nextSession", 120},
+	}
+	for _, h := range hearings {
+		at := start.Add(time.Duration(h.minutes) * time.Minute)
+		if err := db.AddHearingAndSongIfNeededAt(h.song, at); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+
+	tests := []struct {
+		opts SuggestionOptions
+		want []string
+	}{
+		{SuggestionOptions{}, []string{"after", "before", "nextSession"}},
+		{SuggestionOptions{Direction: DirectionBefore}, []string{"before"}},
+		{SuggestionOptions{Direction: DirectionAfter}, []string{"after", "nextSession"}},
+		{SuggestionOptions{Direction: DirectionAfter, SessionGap: 30 * time.Minute}, []string{"after"}},
+	}
+	for _, test := range tests {
+		songs, err := db.ListSuggestionsForSeeds([]string{"seed"}, test.opts)
+		if err != nil {
+			t.Fatalf("Could not list suggestions with %+v: %v", test.opts, err)
+		}
+		if !reflect.DeepEqual(songs, test.want) {
+			t.Errorf("Got suggestions %q with %+v, want %q", songs, test.opts, test.want)
+		}
+	}
+}
+
+func TestSuggestionSessionGapWithOmit(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	hearings := []songHearing{
+		{"seed", start},
+		{"omitted", start.Add(20 * time.Minute)},
+		{"after", start.Add(40 * time.Minute)},
+		{"omitted", time.Now().Add(-time.Minute)},
+	}
+	addHearings(t, db, hearings)
+
+	// The omitted song still connects the seed and "after" to a session.
+	opts := SuggestionOptions{SessionGap: 30 * time.Minute}
+	opts.Omit = time.Hour
+	songs, err := db.ListSuggestionsForSeeds([]string{"seed"}, opts)
+	if err != nil {
+		t.Fatalf("Could not list suggestions: %v", err)
+	}
+	if want := []string{"after"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got suggestions %q, want %q", songs, want)
+	}
+}
@@ -0,0 +1,309 @@
+package songmem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// errNoTags indicates, that a file contains no artist or title tags,
+// that could be read.
+var errNoTags = errors.New("no tags found")
+
+// readTags reads the artist and title tags of the given audio file.
+// ID3v2 tags and Vorbis comments in FLAC, Ogg Vorbis and Opus files are
+// supported.
+func readTags(path string) (artist, title string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil {
+		return "", "", errNoTags
+	}
+	var tags map[string]string
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		tags, err = readID3v2(r)
+	case bytes.Equal(magic, []byte("fLaC")):
+		tags, err = readFLACComments(r)
+	case bytes.Equal(magic, []byte("OggS")):
+		tags, err = readOggComments(r)
+	default:
+		err = errNoTags
+	}
+	if err != nil {
+		return
+	}
+	artist, title = tags["ARTIST"], tags["TITLE"]
+	if title == "" {
+		err = errNoTags
+	}
+	return
+}
+
+// maxID3TextFrame is the size of the largest text frame, that is read
+// from ID3v2 tags. Tags are not trusted, so larger frames are skipped
+// instead of allocating memory for them.
+const maxID3TextFrame = 1 << 16
+
+// maxFLACComments is the size of the largest VORBIS_COMMENT block, that
+// is read from FLAC files. Other metadata blocks, like embedded
+// pictures, are skipped without reading them into memory.
+const maxFLACComments = 1 << 20
+
+// readID3v2 reads the artist and title frames of an ID3v2 tag. The
+// other frames, like embedded pictures, are skipped without reading
+// them into memory.
+func readID3v2(r io.Reader) (map[string]string, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	version, flags := header[3], header[5]
+	if flags&0x80 != 0 {
+		// Unsynchronised tags are rare and not worth the effort.
+		return nil, errNoTags
+	}
+	tag := io.LimitReader(r, int64(syncsafe(header[6:10])))
+	if flags&0x40 != 0 && version >= 3 {
+		var extHeader [4]byte
+		if _, err := io.ReadFull(tag, extHeader[:]); err != nil {
+			return nil, errNoTags
+		}
+		// The size includes the size field itself only in version 4.
+		extSize := int64(binary.BigEndian.Uint32(extHeader[:]))
+		if version > 3 {
+			extSize = int64(syncsafe(extHeader[:])) - 4
+		}
+		if extSize < 0 {
+			return nil, errNoTags
+		}
+		if _, err := io.CopyN(ioutil.Discard, tag, extSize); err != nil {
+			return nil, errNoTags
+		}
+	}
+
+	idLen, headerLen := 4, 10
+	artistID, titleID := "TPE1", "TIT2"
+	if version == 2 {
+		idLen, headerLen = 3, 6
+		artistID, titleID = "TP1", "TT2"
+	}
+	tags := make(map[string]string)
+	frameHeader := make([]byte, headerLen)
+	for {
+		if _, err := io.ReadFull(tag, frameHeader); err != nil || frameHeader[0] == 0 {
+			break
+		}
+		id := string(frameHeader[:idLen])
+		var size int
+		switch version {
+		case 2:
+			size = int(frameHeader[3])<<16 | int(frameHeader[4])<<8 | int(frameHeader[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(frameHeader[4:8]))
+		default:
+			size = syncsafe(frameHeader[4:8])
+		}
+		if (id != artistID && id != titleID) || size > maxID3TextFrame {
+			if _, err := io.CopyN(ioutil.Discard, tag, int64(size)); err != nil {
+				break
+			}
+			continue
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(tag, frame); err != nil {
+			break
+		}
+		switch id {
+		case artistID:
+			tags["ARTIST"] = decodeID3Text(frame)
+		case titleID:
+			tags["TITLE"] = decodeID3Text(frame)
+		}
+	}
+	return tags, nil
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// decodeID3Text decodes the content of an ID3v2 text frame. If the
+// frame contains multiple values, only the first one is returned.
+func decodeID3Text(frame []byte) string {
+	if len(frame) == 0 {
+		return ""
+	}
+	encoding, text := frame[0], frame[1:]
+	switch encoding {
+	case 0: // ISO-8859-1
+		runes := make([]rune, 0, len(text))
+		for _, b := range text {
+			if b == 0 {
+				break
+			}
+			runes = append(runes, rune(b))
+		}
+		return string(runes)
+	case 1, 2: // UTF-16 with BOM or UTF-16BE
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == 1 && len(text) >= 2 {
+			if text[0] == 0xff && text[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			text = text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			u := order.Uint16(text[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	default: // UTF-8
+		if i := bytes.IndexByte(text, 0); i >= 0 {
+			text = text[:i]
+		}
+		return string(text)
+	}
+}
+
+func readFLACComments(r io.Reader) (map[string]string, error) {
+	if _, err := io.ReadFull(r, make([]byte, 4)); err != nil {
+		return nil, err
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		last, blockType := header[0]&0x80 != 0, header[0]&0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if blockType == 4 {
+			if size > maxFLACComments {
+				return nil, errors.New("the FLAC comments are too large")
+			}
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, err
+			}
+			return parseVorbisComments(block), nil
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(size)); err != nil {
+			return nil, err
+		}
+		if last {
+			return nil, errNoTags
+		}
+	}
+}
+
+func readOggComments(r io.Reader) (map[string]string, error) {
+	// The comments are in the second packet of the stream. Only the
+	// first megabyte is searched.
+	const maxLen = 1 << 20
+	var packets [][]byte
+	var packet []byte
+	for read := 0; len(packets) < 2 && read < maxLen; {
+		var header [27]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, errNoTags
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, err
+		}
+		for _, segLen := range segments {
+			segment := make([]byte, segLen)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, err
+			}
+			read += int(segLen)
+			packet = append(packet, segment...)
+			if segLen < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	if len(packets) < 2 {
+		return nil, errNoTags
+	}
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		return parseVorbisComments(comments[7:]), nil
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		return parseVorbisComments(comments[8:]), nil
+	}
+	return nil, errNoTags
+}
+
+// parseVorbisComments parses a Vorbis comment structure. Keys are
+// converted to upper case. Parsing stops silently at malformed data.
+func parseVorbisComments(b []byte) map[string]string {
+	tags := make(map[string]string)
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n > len(b)-4 {
+			return nil, false
+		}
+		field := b[4 : 4+n]
+		b = b[4+n:]
+		return field, true
+	}
+	if _, ok := next(); !ok { // The vendor string.
+		return tags
+	}
+	if len(b) < 4 {
+		return tags
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		kv := strings.SplitN(string(comment), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToUpper(kv[0])
+		if _, exists := tags[key]; !exists {
+			tags[key] = kv[1]
+		}
+	}
+	return tags
+}
+
+// isAudioFile determines by the extension, whether path is an audio
+// file.
+func isAudioFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".aac",
+		".wav", ".wma", ".aiff", ".ape", ".wv", ".mpc":
+		return true
+	}
+	return false
+}
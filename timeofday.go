@@ -0,0 +1,81 @@
+package songmem
+
+import (
+	"math"
+	"time"
+)
+
+// timeOfDayHalfLife is the difference in the time of day, at which a
+// hearing counts half as much towards the fit of a song to a moment.
+const timeOfDayHalfLife = time.Hour
+
+// ListSongsForTimeOfDay lists songs, that you recently heard a lot
+// around the time of day and on the weekday of t. Best fitting songs
+// first.
+func (db SongDB) ListSongsForTimeOfDay(t time.Time, opts QueryOptions) (songs []string, err error) {
+	scoredSongs, err := db.RankSongsForTimeOfDay(t, opts)
+	return scoredSongsToNames(scoredSongs), err
+}
+
+// RankSongsForTimeOfDay ranks songs by how well they fit the time of
+// day and weekday of t.
+//
+// Every hearing contributes to the score of its song with the product
+// of its frecency, see RankFrecentSongs, and its fit to t. Hearings fit
+// t less, the further their time of day is from t's; their fit halves
+// every hour. Hearings on the same weekday as t fit fully, hearings on
+// other workdays or other days of the weekend fit half and the rest a
+// quarter. The time of day and weekday of a hearing are those of the
+// timezone it was registered in.
+func (db SongDB) RankSongsForTimeOfDay(t time.Time, opts QueryOptions) (songs []ScoredSong, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	shs, err := db.querySongHearings(opts)
+	if err != nil {
+		return
+	}
+	return songHearingsToTimeOfDaySongs(shs, t, opts), nil
+}
+
+func songHearingsToTimeOfDaySongs(shs []songHearing, t time.Time, opts QueryOptions) []ScoredSong {
+	now := time.Now()
+	frecencyLambda := math.Ln2 / opts.frecencyHalfLife().Hours()
+	timeOfDayLambda := math.Ln2 / timeOfDayHalfLife.Minutes()
+	scores := make(map[string]float64)
+	for _, sh := range shs {
+		hearingAge := math.Max(0, now.Sub(sh.Date).Hours())
+		fit := math.Exp(-timeOfDayLambda*clockDistance(sh.Date, t).Minutes()) *
+			weekdayFit(sh.Date.Weekday(), t.Weekday())
+		scores[sh.Name] += math.Exp(-frecencyLambda*hearingAge) * fit
+	}
+	return rankSongs(scores, shs, opts.Offset, opts.Limit)
+}
+
+// clockDistance returns the difference between the wall-clock times of
+// a and b, ignoring their dates. It is at most 12 hours.
+func clockDistance(a, b time.Time) time.Duration {
+	clock := func(t time.Time) time.Duration {
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+			time.Duration(t.Second())*time.Second
+	}
+	d := clock(a) - clock(b)
+	if d < 0 {
+		d = -d
+	}
+	if d > 12*time.Hour {
+		d = 24*time.Hour - d
+	}
+	return d
+}
+
+func weekdayFit(a, b time.Weekday) float64 {
+	isWeekend := func(d time.Weekday) bool { return d == time.Saturday || d == time.Sunday }
+	switch {
+	case a == b:
+		return 1
+	case isWeekend(a) == isWeekend(b):
+		return 0.5
+	}
+	return 0.25
+}
@@ -0,0 +1,62 @@
+package songmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankSongsForTimeOfDay(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// A Wednesday, two weeks ago.
+	now := time.Now()
+	wednesday := time.Date(now.Year(), now.Month(), now.Day()-14, 0, 0, 0, 0, time.UTC)
+	for wednesday.Weekday() != time.Wednesday {
+		wednesday = wednesday.AddDate(0, 0, -1)
+	}
+	tokyo := time.FixedZone("JST", 9*60*60)
+	hearings := []songHearing{
+		{"morning", wednesday.Add(8 * time.Hour)},
+		{"morning", wednesday.Add(8*time.Hour + 5*time.Minute)},
+		{"evening", wednesday.Add(20 * time.Hour)},
+		{"evening", wednesday.Add(20*time.Hour + 5*time.Minute)},
+		// 8:00 in Tokyo, although it is 23:00 in UTC.
+		{"tokyoMorning", wednesday.Add(-time.Hour).In(tokyo)},
+	}
+	addHearings(t, db, hearings)
+
+	songs, err := db.ListSongsForTimeOfDay(wednesday.AddDate(0, 0, 7).Add(8*time.Hour), QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"morning", "tokyoMorning", "evening"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got songs %q for the morning, want %q", songs, want)
+	}
+	songs, err = db.ListSongsForTimeOfDay(wednesday.Add(20*time.Hour), QueryOptions{})
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if songs[0] != "evening" {
+		t.Errorf("Got songs %q for the evening, want evening first", songs)
+	}
+}
+
+func TestClockDistance(t *testing.T) {
+	base := time.Date(2020, 5, 17, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		other time.Time
+		want  time.Duration
+	}{
+		{base.Add(time.Hour), time.Hour},
+		{base.AddDate(0, 0, -3), 0},
+		{time.Date(2020, 5, 17, 0, 30, 0, 0, time.UTC), time.Hour},
+		{time.Date(2020, 5, 17, 11, 30, 0, 0, time.UTC), 12 * time.Hour},
+	}
+	for _, test := range tests {
+		if got := clockDistance(base, test.other); got != test.want {
+			t.Errorf("Got distance %v between %v and %v, want %v", got, base, test.other, test.want)
+		}
+	}
+}
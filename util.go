@@ -1,27 +1,108 @@
 package songmem
 
 import (
+	"container/heap"
 	"sort"
+	"time"
 )
 
-type songRating struct {
-	Song   string
-	Rating float64
+// ScoredSong is a song together with the score, by which it was ranked.
+// The meaning of the score depends on the ranking; higher is better.
+// HearingCount and LastHeard only cover the hearings between the Since
+// and Until of the ranking's options, if it has any.
+type ScoredSong struct {
+	Name         string
+	Score        float64
+	HearingCount int
+	LastHeard    time.Time
 }
 
-// songRatingsToSongs returns a slice of songs, ordered by their rating.
-func songRatingsToSongs(ratingsMap map[string]float64) []string {
-	songRatings := make([]songRating, 0, len(ratingsMap))
-	for song, rating := range ratingsMap {
-		songRatings = append(songRatings, songRating{song, rating})
+// rankSongs returns the rated songs, ordered by their rating. Songs
+// with the same rating are ordered by name. The first offset songs
+// are skipped and at most limit songs are returned; a limit of 0
+// means no limit. HearingCount and LastHeard are taken from shs.
+//
+// With a limit, only the best offset+limit songs are sorted, which
+// are selected with a heap.
+func rankSongs(ratingsMap map[string]float64, shs []songHearing, offset, limit int) []ScoredSong {
+	var scoredSongs []ScoredSong
+	if limit > 0 {
+		top := &scoredSongHeap{}
+		k := offset + limit
+		for song, rating := range ratingsMap {
+			s := ScoredSong{Name: song, Score: rating}
+			if top.Len() < k {
+				heap.Push(top, s)
+			} else if betterScoredSong(s, (*top)[0]) {
+				(*top)[0] = s
+				heap.Fix(top, 0)
+			}
+		}
+		scoredSongs = *top
+	} else {
+		scoredSongs = make([]ScoredSong, 0, len(ratingsMap))
+		for song, rating := range ratingsMap {
+			scoredSongs = append(scoredSongs, ScoredSong{Name: song, Score: rating})
+		}
 	}
-	sort.Slice(songRatings, func(i, j int) bool {
-		return songRatings[i].Rating > songRatings[j].Rating
+	sort.Slice(scoredSongs, func(i, j int) bool {
+		return betterScoredSong(scoredSongs[i], scoredSongs[j])
 	})
+	scoredSongs = paginate(scoredSongs, offset, limit)
 
-	songs := make([]string, 0, len(songRatings))
-	for _, songRating := range songRatings {
-		songs = append(songs, songRating.Song)
+	indices := make(map[string]int, len(scoredSongs))
+	for i, s := range scoredSongs {
+		indices[s.Name] = i
+	}
+	for _, sh := range shs {
+		if i, ok := indices[sh.Name]; ok {
+			scoredSongs[i].HearingCount++
+			if sh.Date.After(scoredSongs[i].LastHeard) {
+				scoredSongs[i].LastHeard = sh.Date
+			}
+		}
+	}
+	return scoredSongs
+}
+
+func betterScoredSong(a, b ScoredSong) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Name < b.Name
+}
+
+// scoredSongHeap is a heap, whose root is the worst song.
+type scoredSongHeap []ScoredSong
+
+func (h scoredSongHeap) Len() int            { return len(h) }
+func (h scoredSongHeap) Less(i, j int) bool  { return betterScoredSong(h[j], h[i]) }
+func (h scoredSongHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoredSongHeap) Push(x interface{}) { *h = append(*h, x.(ScoredSong)) }
+func (h *scoredSongHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// paginate skips the first offset songs and returns at most limit of
+// the rest. A limit of 0 means no limit.
+func paginate(songs []ScoredSong, offset, limit int) []ScoredSong {
+	if offset >= len(songs) {
+		return songs[:0]
+	}
+	songs = songs[offset:]
+	if limit > 0 && limit < len(songs) {
+		songs = songs[:limit]
+	}
+	return songs
+}
+
+func scoredSongsToNames(scoredSongs []ScoredSong) []string {
+	songs := make([]string, 0, len(scoredSongs))
+	for _, s := range scoredSongs {
+		songs = append(songs, s.Name)
 	}
 	return songs
 }
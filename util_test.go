@@ -0,0 +1,68 @@
+package songmem
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRankSongsLimit(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ratings := make(map[string]float64)
+	for i := 0; i < 200; i++ {
+		// Few distinct ratings, so that many songs are ordered by name.
+		ratings[fmt.Sprint("song", i)] = float64(r.Intn(10))
+	}
+	all := rankSongs(ratings, nil, 0, 0)
+	if len(all) != len(ratings) {
+		t.Fatalf("Got %d songs without limit, want %d", len(all), len(ratings))
+	}
+	tests := []struct{ offset, limit int }{
+		{0, 1}, {0, 10}, {5, 10}, {195, 10}, {250, 10}, {20, 0},
+	}
+	for _, test := range tests {
+		got := rankSongs(ratings, nil, test.offset, test.limit)
+		want := paginate(append([]ScoredSong(nil), all...), test.offset, test.limit)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Got %v with offset %d and limit %d, want %v",
+				got, test.offset, test.limit, want)
+		}
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	for _, song := range []string{"a", "b", "b", "c", "c", "c"} {
+		if err := db.AddHearingAndSongIfNeeded(song); err != nil {
+			t.Fatalf("Could not add hearing: %v", err)
+		}
+	}
+	opts := QueryOptions{Offset: 1, Limit: 1}
+	favourites, err := db.RankFavourites(opts)
+	if err != nil {
+		t.Fatalf("Could not rank favourites: %v", err)
+	}
+	if len(favourites) != 1 || favourites[0].Name != "b" {
+		t.Errorf("Got favourites %+v, want b", favourites)
+	}
+	songs, err := db.ListSongsInOrderOfAdditionWithOptions(opts)
+	if err != nil {
+		t.Fatalf("Could not list songs: %v", err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(songs, want) {
+		t.Errorf("Got songs %q, want %q", songs, want)
+	}
+	frecent, err := db.RankFrecentSongs(QueryOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("Could not rank frecent songs: %v", err)
+	}
+	if len(frecent) != 2 || frecent[0].Name != "c" || frecent[0].HearingCount != 3 {
+		t.Errorf("Got frecent songs %+v, want c and b", frecent)
+	}
+	if _, err = db.RankFavourites(QueryOptions{Limit: -1}); err == nil {
+		t.Errorf("Ranking favourites with a negative limit did not fail")
+	}
+}
@@ -0,0 +1,259 @@
+package songmem
+
+import (
+	"database/sql"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	wrappedTopSongs   = 25
+	wrappedTopArtists = 10
+
+	// wrappedDiscoveryRank is the rank among the year's most heard songs,
+	// that a song added in the year must reach, to be a discovery.
+	wrappedDiscoveryRank = 100
+)
+
+// YearInReview summarizes the hearings of a year. Years, months and
+// days are those of the timezone, in which each hearing was
+// registered.
+type YearInReview struct {
+	Year     int
+	Hearings int
+
+	// TopSongs are the 25 and TopArtists the 10 most heard songs and
+	// artists of the year, most heard first.
+	TopSongs   []Count
+	TopArtists []Count
+
+	// FirstSong is the first song heard in the year, at FirstHeardAt.
+	FirstSong    string
+	FirstHeardAt time.Time
+
+	// Discoveries are the songs, that were added in the year and are
+	// among its 100 most heard songs, most heard first.
+	Discoveries []Count
+
+	// MostReplayedDay is the day, on which a single song was heard most
+	// often.
+	MostReplayedDay Replay
+
+	// MonthlyTopSongs are the most heard songs of each month, starting
+	// with January. Months without hearings have an empty Count.
+	MonthlyTopSongs [12]Count
+}
+
+// Replay is a song, that was heard multiple times on a day.
+type Replay struct {
+	Date     string // Like 2006-01-02.
+	Song     string
+	Hearings int
+}
+
+// ReportFormat identifies the format of a YearInReview report.
+type ReportFormat string
+
+const (
+	// Markdown writes the report as a Markdown document.
+	Markdown ReportFormat = "markdown"
+
+	// HTML writes the report as a standalone HTML page.
+	HTML ReportFormat = "html"
+)
+
+// YearInReview summarizes the hearings of the given year.
+func (db SongDB) YearInReview(year int) (review YearInReview, err error) {
+	review.Year = year
+	// Timezones are at most 14 hours away from UTC.
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Add(-14 * time.Hour)
+	to := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC).Add(14 * time.Hour)
+	rows, err := db.Query(`SELECT name, artist, addedAt, heardAt FROM hearing
+	                       INNER JOIN song ON song.id = hearing.songID
+	                       WHERE heardAtUnix BETWEEN ? AND ?
+	                       ORDER BY heardAtUnix, hearing.id`, from.Unix(), to.Unix())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	songs := make(map[string]int)
+	artists := make(map[string]int)
+	added := make(map[string]bool)
+	var months [12]map[string]int
+	replays := make(map[Replay]int)
+	for rows.Next() {
+		var name, addedAt, heardAt string
+		var artist sql.NullString
+		if err = rows.Scan(&name, &artist, &addedAt, &heardAt); err != nil {
+			return
+		}
+		var t, addedAtTime time.Time
+		if t, err = time.Parse(time.RFC3339, heardAt); err != nil {
+			return
+		}
+		if addedAtTime, err = time.Parse(time.RFC3339, addedAt); err != nil {
+			return
+		}
+		if t.Year() != year {
+			continue
+		}
+		if review.Hearings == 0 || t.Before(review.FirstHeardAt) {
+			review.FirstSong, review.FirstHeardAt = name, t
+		}
+		review.Hearings++
+		songs[name]++
+		if artist.Valid {
+			artists[artist.String]++
+		}
+		added[name] = addedAtTime.Year() == year
+		if months[t.Month()-1] == nil {
+			months[t.Month()-1] = make(map[string]int)
+		}
+		months[t.Month()-1][name]++
+		replays[Replay{Date: t.Format("2006-01-02"), Song: name}]++
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	review.TopSongs = topCounts(songs, wrappedTopSongs)
+	review.TopArtists = topCounts(artists, wrappedTopArtists)
+	for _, c := range topCounts(songs, wrappedDiscoveryRank) {
+		if added[c.Name] {
+			review.Discoveries = append(review.Discoveries, c)
+		}
+	}
+	for i, m := range months {
+		if top := topCounts(m, 1); len(top) == 1 {
+			review.MonthlyTopSongs[i] = top[0]
+		}
+	}
+	for r, n := range replays {
+		best := review.MostReplayedDay
+		if n > best.Hearings || n == best.Hearings &&
+			(r.Date < best.Date || r.Date == best.Date && r.Song < best.Song) {
+			r.Hearings = n
+			review.MostReplayedDay = r
+		}
+	}
+	return
+}
+
+// WriteReport writes the review as a report in the given format.
+func (review YearInReview) WriteReport(w io.Writer, format ReportFormat) error {
+	funcs := map[string]interface{}{
+		"inc":   func(i int) int { return i + 1 },
+		"month": func(i int) string { return time.Month(i + 1).String() },
+		"md":    escapeMarkdown,
+		"hearings": func(n int) string {
+			if n == 1 {
+				return "1 hearing"
+			}
+			return fmt.Sprintf("%d hearings", n)
+		},
+	}
+	switch format {
+	case Markdown:
+		t := template.Must(template.New("").Funcs(funcs).Parse(markdownReport))
+		return t.Execute(w, review)
+	case HTML:
+		t := htmltemplate.Must(htmltemplate.New("").Funcs(funcs).Parse(htmlReport))
+		return t.Execute(w, review)
+	}
+	return fmt.Errorf("unknown report format '%s'", format)
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`,
+	`[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+const markdownReport = `# {{.Year}} in review
+
+You heard {{.Hearings}} songs in {{.Year}}.
+{{- if .FirstSong}} The first one was {{md .FirstSong}}, on {{.FirstHeardAt.Format "January 2 at 15:04"}}.{{end}}
+
+## Top songs
+{{range $i, $c := .TopSongs}}
+{{inc $i}}. {{md $c.Name}} ({{hearings $c.Hearings}})
+{{- end}}
+
+## Top artists
+{{range $i, $c := .TopArtists}}
+{{inc $i}}. {{md $c.Name}} ({{hearings $c.Hearings}})
+{{- end}}
+
+## Discoveries
+{{range .Discoveries}}
+- {{md .Name}} ({{hearings .Hearings}})
+{{- else}}
+No new song made it into your favourites.
+{{- end}}
+{{- with .MostReplayedDay}}{{if .Hearings}}
+
+## Most replayed day
+
+On {{.Date}}, you heard {{md .Song}} {{.Hearings}} times.
+{{- end}}{{end}}
+
+## Top song of each month
+
+| Month | Song | Hearings |
+| --- | --- | --- |
+{{- range $i, $c := .MonthlyTopSongs}}{{if $c.Hearings}}
+| {{month $i}} | {{md $c.Name}} | {{$c.Hearings}} |
+{{- end}}{{end}}
+`
+
+const htmlReport = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Year}} in review</title>
+</head>
+<body>
+<h1>{{.Year}} in review</h1>
+<p>You heard {{.Hearings}} songs in {{.Year}}.
+{{- if .FirstSong}} The first one was {{.FirstSong}}, on {{.FirstHeardAt.Format "January 2 at 15:04"}}.{{end}}</p>
+<h2>Top songs</h2>
+<ol>
+{{- range .TopSongs}}
+<li>{{.Name}} ({{hearings .Hearings}})</li>
+{{- end}}
+</ol>
+<h2>Top artists</h2>
+<ol>
+{{- range .TopArtists}}
+<li>{{.Name}} ({{hearings .Hearings}})</li>
+{{- end}}
+</ol>
+<h2>Discoveries</h2>
+{{- if .Discoveries}}
+<ul>
+{{- range .Discoveries}}
+<li>{{.Name}} ({{hearings .Hearings}})</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>No new song made it into your favourites.</p>
+{{- end}}
+{{- with .MostReplayedDay}}{{if .Hearings}}
+<h2>Most replayed day</h2>
+<p>On {{.Date}}, you heard {{.Song}} {{.Hearings}} times.</p>
+{{- end}}{{end}}
+<h2>Top song of each month</h2>
+<table>
+<tr><th>Month</th><th>Song</th><th>Hearings</th></tr>
+{{- range $i, $c := .MonthlyTopSongs}}{{if $c.Hearings}}
+<tr><td>{{month $i}}</td><td>{{$c.Name}}</td><td>{{$c.Hearings}}</td></tr>
+{{- end}}{{end}}
+</table>
+</body>
+</html>
+`
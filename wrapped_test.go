@@ -0,0 +1,72 @@
+package songmem
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestYearInReview(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	date := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2020, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	hearings := []songHearing{
+		{"Old - song", date(time.January, 1, 0).AddDate(0, 0, -10)},
+		// Already 2020 in Tokyo.
+		{"Old - song", date(time.January, 1, 0).Add(-2 * time.Hour).In(tokyo)},
+		{"New - <song>", date(time.March, 3, 10)},
+		{"New - <song>", date(time.March, 3, 11)},
+		{"New - <song>", date(time.March, 3, 12)},
+		{"Old - song", date(time.March, 4, 10)},
+		{"Old - song", date(time.December, 31, 20)},
+		// Already 2021 in Tokyo.
+		{"New - <song>", date(time.December, 31, 20).In(tokyo)},
+	}
+	addHearings(t, db, hearings)
+
+	review, err := db.YearInReview(2020)
+	if err != nil {
+		t.Fatalf("Could not review year: %v", err)
+	}
+	if review.Hearings != 6 || review.FirstSong != "Old - song" {
+		t.Errorf("Got %d hearings, first %q, want 6, first Old - song",
+			review.Hearings, review.FirstSong)
+	}
+	wantSongs := []Count{{"New - <song>", 3}, {"Old - song", 3}}
+	if !reflect.DeepEqual(review.TopSongs, wantSongs) {
+		t.Errorf("Got top songs %v, want %v", review.TopSongs, wantSongs)
+	}
+	if want := []Count{{"New - <song>", 3}}; !reflect.DeepEqual(review.Discoveries, want) {
+		t.Errorf("Got discoveries %v, want %v", review.Discoveries, want)
+	}
+	if want := (Replay{"2020-03-03", "New - <song>", 3}); review.MostReplayedDay != want {
+		t.Errorf("Got most replayed day %v, want %v", review.MostReplayedDay, want)
+	}
+	if want := (Count{"Old - song", 1}); review.MonthlyTopSongs[0] != want {
+		t.Errorf("Got top song %v for January, want %v", review.MonthlyTopSongs[0], want)
+	}
+	if review.MonthlyTopSongs[1].Hearings != 0 {
+		t.Errorf("Got top song %v for February, want none", review.MonthlyTopSongs[1])
+	}
+
+	var buf bytes.Buffer
+	if err = review.WriteReport(&buf, Markdown); err != nil {
+		t.Fatalf("Could not write Markdown report: %v", err)
+	}
+	if !strings.Contains(buf.String(), `1. New - \<song\> (3 hearings)`) {
+		t.Errorf("Markdown report lacks the top song:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err = review.WriteReport(&buf, HTML); err != nil {
+		t.Fatalf("Could not write HTML report: %v", err)
+	}
+	if !strings.Contains(buf.String(), `<li>New - &lt;song&gt; (3 hearings)</li>`) {
+		t.Errorf("HTML report lacks the top song:\n%s", buf.String())
+	}
+}